@@ -0,0 +1,122 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// ChangedFiles returns the files changed in the git repository at dir,
+// as slash-separated paths relative to the repository root.
+//
+// If head is empty, the working tree (including untracked files that
+// are not ignored) is compared against base. Otherwise the changes made
+// on head since it diverged from base are returned, as for
+// "git diff base...head".
+//
+// Renamed files are reported under both their old and new paths.
+func ChangedFiles(ctx context.Context, dir, base, head string) ([]string, error) {
+	top, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	if len(top) != 1 {
+		return nil, fmt.Errorf("git rev-parse: %s: not in a work tree", dir)
+	}
+	dir = strings.TrimSuffix(top[0], "\n")
+
+	var files []string
+	if head == "" {
+		out, err := git(ctx, dir, "diff", "--name-only", "--no-renames", "-z", base)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, out...)
+		out, err = git(ctx, dir, "ls-files", "-z", "--others", "--exclude-standard", "--full-name")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, out...)
+	} else {
+		out, err := git(ctx, dir, "diff", "--name-only", "--no-renames", "-z", base+"..."+head)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, out...)
+	}
+	return files, nil
+}
+
+// Affected returns the commands whose Inputs match at least one of the
+// changed files, in their original order.
+//
+// A command without Inputs is always selected, since nothing is known
+// about what it reads.
+func Affected(cmds []*Cmd, changed []string) []*Cmd {
+	var res []*Cmd
+	for _, c := range cmds {
+		if len(c.Inputs) == 0 || matchAny(c.Inputs, changed) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func matchAny(patterns, names []string) bool {
+	for _, p := range patterns {
+		for _, n := range names {
+			if matchGlob(p, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether name matches the slash-separated pattern.
+// Each element is matched with path.Match, except "**" which matches
+// zero or more elements.
+func matchGlob(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func git(ctx context.Context, dir string, args ...string) ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var lines []string
+	for _, l := range strings.Split(string(out), "\x00") {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,106 @@
+package command
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "a.go", true},
+		{"*.go", "pkg/a.go", false},
+		{"pkg/**", "pkg/a/b.go", true},
+		{"pkg/**/*.go", "pkg/a.go", true},
+		{"pkg/**/*.go", "pkg/a/b/c.go", true},
+		{"pkg/**/*.go", "pkg/a/b/c.txt", false},
+		{"**/go.mod", "go.mod", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAffected(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(name string) {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	write("a/a.go")
+	write("b/b.go")
+	run("add", ".")
+	run("commit", "-q", "-m", "init")
+	write("b/b.go.new")
+	write("b/new.go")
+
+	changed, err := ChangedFiles(context.Background(), dir, "HEAD", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Cmd{Path: "a", Inputs: []string{"a/**"}}
+	b := &Cmd{Path: "b", Inputs: []string{"b/*.go"}}
+	c := &Cmd{Path: "c"}
+	got := Affected([]*Cmd{a, b, c}, changed)
+	if want := []*Cmd{b, c}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Affected = %v, want %v", got, want)
+	}
+}
+
+func TestChangedFilesRenamed(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	for _, name := range []string{"a/a.go", "b/b.go"} {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("init", "-q")
+	run("add", ".")
+	run("commit", "-q", "-m", "init")
+	os.MkdirAll(filepath.Join(dir, "c"), 0755)
+	run("mv", "a/a.go", "c/a.go")
+	os.WriteFile(filepath.Join(dir, "a", "new.go"), nil, 0644)
+
+	// From a subdirectory, changes elsewhere in the repository are
+	// reported too.
+	changed, err := ChangedFiles(context.Background(), filepath.Join(dir, "b"), "HEAD", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(changed)
+	if want := []string{"a/a.go", "a/new.go", "c/a.go"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("ChangedFiles = %q, want %q", changed, want)
+	}
+}
@@ -0,0 +1,186 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Approver approves the commands with Cmd.Gate set before they start.
+type Approver interface {
+	// Approve reports whether c may run. It must return when ctx is
+	// done.
+	Approve(ctx context.Context, c *Cmd) (bool, error)
+}
+
+// ErrDenied is the error of a command not approved to run, with
+// StatusDenied.
+var ErrDenied = errors.New("command: not approved")
+
+// approve asks b.Approver to approve c. It returns nil if c may run,
+// or its result otherwise.
+func (b *Batch) approve(ctx context.Context, c *Cmd) *Result {
+	if b.Approver == nil {
+		return &Result{Cmd: c, Status: StatusDenied, ExitCode: -1, Err: fmt.Errorf("%w: no approver", ErrDenied)}
+	}
+	if b.ApprovalTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.ApprovalTimeout)
+		defer cancel()
+	}
+	ok, err := b.Approver.Approve(ctx, c)
+	switch {
+	case err != nil:
+		err = fmt.Errorf("%w: %w", ErrDenied, err)
+	case !ok:
+		err = ErrDenied
+	default:
+		return nil
+	}
+	return &Result{Cmd: c, Status: StatusDenied, ExitCode: -1, Err: err}
+}
+
+// AutoApprover approves all commands if true, and denies them all
+// otherwise.
+type AutoApprover bool
+
+// Approve returns a.
+func (a AutoApprover) Approve(ctx context.Context, c *Cmd) (bool, error) {
+	return bool(a), nil
+}
+
+// TTYApprover asks for approval on a terminal.
+type TTYApprover struct {
+	// In and Out are the terminal, /dev/tty if nil, which Close
+	// closes.
+	In  io.Reader
+	Out io.Writer
+
+	mu    sync.Mutex
+	tty   *os.File
+	lines chan string // read from In
+	err   error       // of In, once lines is closed
+}
+
+// Approve prompts for c on the terminal, one command at a time, and
+// approves it if the answer is "y" or "yes". Answers typed before the
+// prompt, such as one given too late for the previous command, are
+// discarded.
+func (a *TTYApprover) Approve(ctx context.Context, c *Cmd) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.start(); err != nil {
+		return false, err
+	}
+	for stale := true; stale; {
+		select {
+		case _, ok := <-a.lines:
+			if !ok {
+				return false, a.err
+			}
+		default:
+			stale = false
+		}
+	}
+
+	fmt.Fprintf(a.Out, "Run %s: %s? [y/N] ", c.name(), strings.Join(append([]string{c.Path}, c.Args...), " "))
+	select {
+	case line, ok := <-a.lines:
+		if !ok {
+			return false, a.err
+		}
+		line = strings.ToLower(strings.TrimSpace(line))
+		return line == "y" || line == "yes", nil
+	case <-ctx.Done():
+		fmt.Fprintln(a.Out)
+		return false, ctx.Err()
+	}
+}
+
+// start opens the terminal if needed and starts reading it.
+// a.mu must be held.
+func (a *TTYApprover) start() error {
+	if a.lines != nil {
+		return nil
+	}
+	if a.In == nil || a.Out == nil {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+		a.tty = tty
+		if a.In == nil {
+			a.In = tty
+		}
+		if a.Out == nil {
+			a.Out = tty
+		}
+	}
+	a.lines = make(chan string)
+	go func(r *bufio.Reader, lines chan<- string) {
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				lines <- line
+			}
+			if err != nil {
+				a.err = err
+				close(lines)
+				return
+			}
+		}
+	}(bufio.NewReader(a.In), a.lines)
+	return nil
+}
+
+// Close closes the terminal opened by Approve, if any.
+func (a *TTYApprover) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tty == nil {
+		return nil
+	}
+	return a.tty.Close()
+}
+
+// FileApprover waits for an operator to approve a command by creating
+// the file <label>.approved in Dir, or to deny it with <label>.denied,
+// where the label has its slashes replaced by underscores.
+type FileApprover struct {
+	Dir string
+
+	// Poll is the interval between checks for the files, 1 second if
+	// zero.
+	Poll time.Duration
+}
+
+// Approve waits for the approval or denial file of c to appear.
+func (a *FileApprover) Approve(ctx context.Context, c *Cmd) (bool, error) {
+	base := filepath.Join(a.Dir, strings.ReplaceAll(c.name(), "/", "_"))
+	poll := a.Poll
+	if poll == 0 {
+		poll = time.Second
+	}
+	t := time.NewTicker(poll)
+	defer t.Stop()
+	for {
+		if _, err := os.Stat(base + ".denied"); err == nil {
+			return false, nil
+		}
+		if _, err := os.Stat(base + ".approved"); err == nil {
+			return true, nil
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
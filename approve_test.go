@@ -0,0 +1,146 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApproval(t *testing.T) {
+	cmds := []*Cmd{
+		{Label: "safe", Path: "true"},
+		{Label: "rm", Path: "true", Gate: true},
+	}
+	b := &Batch{Cmds: cmds, Approver: AutoApprover(false)}
+	results, err := b.Run(context.Background())
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("err = %v, want ErrDenied", err)
+	}
+	if results[0].Status != StatusOK || results[1].Status != StatusDenied {
+		t.Errorf("statuses %v %v, want ok denied", results[0].Status, results[1].Status)
+	}
+
+	b.Approver = AutoApprover(true)
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+// chanApprover tells asked when asked to approve a command, and
+// approves it once told to.
+type chanApprover struct {
+	asked  chan struct{}
+	answer chan bool
+}
+
+func (a chanApprover) Approve(ctx context.Context, c *Cmd) (bool, error) {
+	a.asked <- struct{}{}
+	select {
+	case ok := <-a.answer:
+		return ok, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func TestApprovalPool(t *testing.T) {
+	p := &Pool{Slots: 1}
+	a := chanApprover{asked: make(chan struct{}), answer: make(chan bool)}
+	gated := &Batch{Cmds: []*Cmd{{Path: "true", Gate: true}}, Pool: p, Parallel: 1, Approver: a}
+	done := make(chan error)
+	go func() {
+		_, err := gated.Run(context.Background())
+		done <- err
+	}()
+	<-a.asked
+
+	// The command waiting for approval takes no slot from the others.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	other := &Batch{Cmds: []*Cmd{{Path: "true", Priority: 1}}, Pool: p}
+	if _, err := other.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a.answer <- true
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+// promptWriter answers each prompt written to it with the next answer.
+type promptWriter struct {
+	strings.Builder
+	answers []string
+	in      io.Writer
+}
+
+func (w *promptWriter) Write(p []byte) (int, error) {
+	if bytes.HasSuffix(p, []byte("[y/N] ")) && len(w.answers) > 0 {
+		go io.WriteString(w.in, w.answers[0])
+		w.answers = w.answers[1:]
+	}
+	return w.Builder.Write(p)
+}
+
+func TestTTYApprover(t *testing.T) {
+	r, w := io.Pipe()
+	out := &promptWriter{answers: []string{"yes\n", "n\n"}, in: w}
+	a := &TTYApprover{In: r, Out: out}
+	c := &Cmd{Label: "drop", Path: "psql", Args: []string{"-c", "drop table t"}}
+	for _, want := range []bool{true, false} {
+		ok, err := a.Approve(context.Background(), c)
+		if err != nil || ok != want {
+			t.Errorf("Approve = %v, %v, want %v", ok, err, want)
+		}
+	}
+	if !strings.HasPrefix(out.String(), "Run drop: psql -c drop table t? [y/N] ") {
+		t.Errorf("prompt %q", out.String())
+	}
+
+	// An answer given after the timeout is not taken for the next one.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if ok, err := a.Approve(ctx, c); ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Approve = %v, %v, want timeout", ok, err)
+	}
+	w.Write([]byte("n\n"))
+	time.Sleep(10 * time.Millisecond) // for the late answer to be read
+	out.answers = []string{"y\n"}
+	if ok, err := a.Approve(context.Background(), c); !ok || err != nil {
+		t.Errorf("Approve = %v, %v, want true", ok, err)
+	}
+
+	w.Close()
+	if _, err := a.Approve(context.Background(), c); err != io.EOF {
+		t.Errorf("err = %v, want EOF", err)
+	}
+}
+
+func TestFileApprover(t *testing.T) {
+	dir := t.TempDir()
+	a := &FileApprover{Dir: dir, Poll: time.Millisecond}
+	b := &Batch{
+		Cmds:            []*Cmd{{Label: "deploy/prod", Path: "true", Gate: true}},
+		Approver:        a,
+		ApprovalTimeout: 10 * time.Millisecond,
+	}
+	results, _ := b.Run(context.Background())
+	if r := results[0]; r.Status != StatusDenied || !errors.Is(r.Err, context.DeadlineExceeded) {
+		t.Errorf("got %v, %v, want denied on timeout", r.Status, r.Err)
+	}
+
+	b.ApprovalTimeout = 0
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		os.WriteFile(filepath.Join(dir, "deploy_prod.approved"), nil, 0644)
+	}()
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
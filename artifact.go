@@ -0,0 +1,123 @@
+package command
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Compression compresses output artifacts.
+type Compression struct {
+	// Ext is appended to the names of the compressed files.
+	Ext string
+
+	// NewWriter returns a writer compressing to w.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// Gzip compresses output artifacts with gzip. Other formats, such as
+// zstd, can be used by providing their Compression.
+var Gzip = &Compression{
+	Ext: ".gz",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+}
+
+// Artifact is a file holding an output stream of a command.
+type Artifact struct {
+	Stream string // "stdout" or "stderr"
+	Path   string
+
+	// Size and SHA256 are the length and hex encoded SHA-256 checksum
+	// of the stream, before compression.
+	Size   int64
+	SHA256 string
+}
+
+// artifact writes an output stream to its file.
+type artifact struct {
+	Artifact
+	f    *os.File
+	zw   io.WriteCloser
+	hash hash.Hash
+}
+
+func (a *artifact) Write(p []byte) (int, error) {
+	a.hash.Write(p)
+	a.Size += int64(len(p))
+	if a.zw != nil {
+		return a.zw.Write(p)
+	}
+	return a.f.Write(p)
+}
+
+// close flushes and closes the file of a and records its checksum.
+func (a *artifact) close() error {
+	a.SHA256 = hex.EncodeToString(a.hash.Sum(nil))
+	var err error
+	if a.zw != nil {
+		err = a.zw.Close()
+	}
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checkArtifacts checks that the artifacts of the commands of b have
+// distinct names.
+func (b *Batch) checkArtifacts() error {
+	seen := make(map[string]bool)
+	for _, c := range b.Cmds {
+		if seen[c.name()] {
+			return fmt.Errorf("command: artifacts: several commands named %q; set their Label", c.name())
+		}
+		seen[c.name()] = true
+	}
+	return nil
+}
+
+// createArtifacts creates the stdout and stderr artifacts of c.
+func (b *Batch) createArtifacts(c *Cmd) ([]*artifact, error) {
+	if err := os.MkdirAll(b.ArtifactDir, 0755); err != nil {
+		return nil, err
+	}
+	var as []*artifact
+	for _, stream := range []string{"stdout", "stderr"} {
+		a := &artifact{
+			Artifact: Artifact{
+				Stream: stream,
+				Path:   filepath.Join(b.ArtifactDir, url.PathEscape(c.name())+"."+stream),
+			},
+			hash: sha256.New(),
+		}
+		if b.Compression != nil {
+			a.Path += b.Compression.Ext
+		}
+		f, err := os.Create(a.Path)
+		if err == nil {
+			a.f = f
+			if b.Compression != nil {
+				a.zw, err = b.Compression.NewWriter(f)
+			}
+		}
+		if err != nil {
+			if f != nil {
+				f.Close()
+			}
+			for _, a := range as {
+				a.close()
+			}
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, nil
+}
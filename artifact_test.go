@@ -0,0 +1,70 @@
+package command
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	b := &Batch{
+		Cmds:        []*Cmd{{Label: "gen/x", Path: "sh", Args: []string{"-c", "seq 1000; echo oops >&2"}}},
+		ArtifactDir: dir,
+		Compression: Gzip,
+	}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	as := results[0].Artifacts
+	if len(as) != 2 || as[0].Stream != "stdout" || as[1].Stream != "stderr" {
+		t.Fatalf("artifacts %+v", as)
+	}
+	if want := filepath.Join(dir, "gen%2Fx.stdout.gz"); as[0].Path != want {
+		t.Errorf("path %q, want %q", as[0].Path, want)
+	}
+	f, err := os.Open(as[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if int64(len(data)) != as[0].Size || hex.EncodeToString(sum[:]) != as[0].SHA256 {
+		t.Errorf("size %d, sha256 %s do not match the content", as[0].Size, as[0].SHA256)
+	}
+	if !bytes.HasPrefix(data, []byte("1\n2\n")) {
+		t.Errorf("content %.10q", data)
+	}
+
+	var report strings.Builder
+	WriteReport(&report, results)
+	if !strings.Contains(report.String(), "    stderr: "+as[1].Path+" (5 bytes, sha256 ") {
+		t.Errorf("report:\n%s", report.String())
+	}
+}
+
+func TestArtifactsDuplicateNames(t *testing.T) {
+	b := &Batch{
+		Cmds:        []*Cmd{NewCmd("echo", 0, "first"), NewCmd("echo", 0, "second")},
+		ArtifactDir: t.TempDir(),
+	}
+	if _, err := b.Run(context.Background()); err == nil {
+		t.Error("no error for commands writing the same artifacts")
+	}
+}
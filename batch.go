@@ -0,0 +1,698 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Batch runs a set of commands concurrently and reports on each of them.
+type Batch struct {
+	Cmds []*Cmd
+
+	// FailFast kills the remaining commands as soon as one fails,
+	// as ConcurrenceComE does.
+	FailFast bool
+
+	// Capture records the standard output and error of every command
+	// in its Result, in addition to writing them to Cmd.Stdout and
+	// Cmd.Stderr.
+	Capture bool
+
+	// TimeoutScale multiplies the Timeout of every command, to adapt
+	// timeouts tuned on fast machines to slower environments. The scaled
+	// timeout is then clamped to [MinTimeout, MaxTimeout], each bound
+	// applying only if non-zero. Commands without a Timeout are not
+	// affected.
+	//
+	// If TimeoutScale, MinTimeout or MaxTimeout is zero, it is read from
+	// the COMMAND_TIMEOUT_SCALE, COMMAND_TIMEOUT_MIN or
+	// COMMAND_TIMEOUT_MAX environment variable respectively.
+	TimeoutScale float64
+	MinTimeout   time.Duration
+	MaxTimeout   time.Duration
+
+	// RunID identifies the run of the batch, for correlating the logs
+	// of its commands. If RunID is empty, every run gets a random one,
+	// reported in Result.RunID and Summary.RunID.
+	RunID string
+
+	// Parallel bounds the number of commands running at once.
+	// Zero means no limit.
+	Parallel int
+
+	// Shuffle starts the commands in a random order, to reveal commands
+	// that depend on the side effects of others. Seed seeds the order:
+	// if it is zero, every run uses a new random seed, reported in
+	// Summary.Seed, which can be set as Seed to replay the same order.
+	Shuffle bool
+	Seed    int64
+
+	// EarliestDeadlineFirst starts the commands in the order of their
+	// Deadline instead of their order in Cmds. Commands without a
+	// Deadline come last. It takes precedence over Shuffle, which only
+	// orders commands of equal deadline.
+	EarliestDeadlineFirst bool
+
+	// SkipMissed skips, with StatusDeadlineMissed, the commands that
+	// cannot finish before their Deadline when it is their turn to
+	// start, judging by their average duration in History.
+	SkipMissed bool
+
+	// History, if not nil, records the result of every command run.
+	// Recording is best effort: its errors are ignored.
+	History *History
+
+	// CompareOutput compares the output and exit code of every command
+	// with those of its previous successful run in History, recording
+	// any difference in Result.Change. It requires Capture. Normalize is
+	// passed to History.Compare.
+	CompareOutput bool
+	Normalize     func(line string) string
+
+	// Keys, if not nil, remembers the successful results of the
+	// commands with an IdempotencyKey, which are returned again instead
+	// of running commands with the same key.
+	Keys *KeyStore
+
+	// Approver approves the commands with Gate set before they start.
+	// A gated command waits for approval, for at most ApprovalTimeout if
+	// not zero, before taking a Parallel or Pool slot. If Approver is
+	// nil, gated commands are denied.
+	Approver        Approver
+	ApprovalTimeout time.Duration
+
+	// CPUBudget, if not zero, limits the total CPU time, user and system,
+	// of the commands. It is measured on the commands that exited and,
+	// on Linux, sampled every CPUSampleInterval (1 second if zero) on the
+	// running ones. Once exceeded, the running commands are killed and
+	// the others are not started, with ErrCPUBudget.
+	CPUBudget         time.Duration
+	CPUSampleInterval time.Duration
+
+	// CancelTriggers let an operator cancel the batch while it runs,
+	// with ErrOperatorCancel.
+	CancelTriggers []CancelTrigger
+
+	// DebugOutput, if not nil, receives a DebugReport for every command
+	// before it starts, with the values of the variables for which
+	// Redact returns true hidden. If Redact is nil, the variables whose
+	// name contains TOKEN, SECRET, PASSWORD, PASSWD, KEY, CREDENTIAL or
+	// AUTH are hidden. The reports of concurrent commands are written
+	// one at a time.
+	DebugOutput io.Writer
+	Redact      func(key string) bool
+
+	// Notifiers are sent a Summary of the batch once all commands are
+	// done. If the commands succeeded, Run returns the first notifier
+	// error.
+	Notifiers []Notifier
+
+	// Pool, if not nil, is shared with other batches: every command
+	// must get one of its slots, on behalf of Tenant, before starting.
+	Pool   *Pool
+	Tenant string
+
+	// ArtifactDir, if not empty, is the directory receiving the standard
+	// output and error of every command as they stream, in the files
+	// <label>.stdout and <label>.stderr, compressed with Compression if
+	// not nil. Their size and SHA-256 checksum before compression are
+	// recorded in Result.Artifacts. Run fails if two commands have the
+	// same label, or the same path if unlabelled.
+	ArtifactDir string
+	Compression *Compression
+
+	// Streams connect the output of commands to the input of others,
+	// which run at the same time. Connected commands do not count
+	// against Parallel, as a consumer holding the last slot would wait
+	// forever for its producer. Run fails if Streams are used with a
+	// Pool, whose quotas they would bypass.
+	Streams []Stream
+
+	// CoverDir, if not empty, collects the coverage data of the Go
+	// programs built with -cover: every command gets its own directory
+	// under <CoverDir>/<RunID> in GOCOVERDIR, recorded in
+	// Result.CoverDir. Once all commands are done, Run merges their data
+	// with go tool covdata into the text profile coverage.out next to
+	// them, reported in Summary.CoverProfile. If the commands succeeded,
+	// Run returns the merge error.
+	CoverDir string
+
+	cpu   *cpuMeter
+	wires wires
+}
+
+// Status is the outcome of a command run by a Batch.
+type Status int
+
+const (
+	StatusOK             Status = iota // the command succeeded
+	StatusFailed                       // the command failed or could not be started
+	StatusCanceled                     // the batch was canceled before the command started
+	StatusDeadlineMissed               // the command was skipped, as it could not meet its deadline
+	StatusRejected                     // the command was rejected by the tenant quotas of the Pool
+	StatusDenied                       // the gated command was not approved
+)
+
+var statusNames = []string{
+	StatusOK:             "ok",
+	StatusFailed:         "failed",
+	StatusCanceled:       "canceled",
+	StatusDeadlineMissed: "deadline-missed",
+	StatusRejected:       "rejected",
+	StatusDenied:         "denied",
+}
+
+func (s Status) String() string {
+	if s >= 0 && int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// MarshalText encodes s as its name.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a Status from its name.
+func (s *Status) UnmarshalText(text []byte) error {
+	for i, name := range statusNames {
+		if name == string(text) {
+			*s = Status(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown status %q", text)
+}
+
+// ErrDeadlineMissed is the error of a command skipped with
+// StatusDeadlineMissed.
+var ErrDeadlineMissed = errors.New("command: deadline missed")
+
+// Result describes a command run by a Batch.
+type Result struct {
+	Cmd   *Cmd
+	RunID string
+	Start time.Time
+	End   time.Time
+
+	// Timeout is the effective timeout of the command, after scaling.
+	Timeout time.Duration
+
+	Status Status
+
+	// CPUTime is the user and system CPU time used by the command and
+	// the children it waited for.
+	CPUTime time.Duration
+
+	// Preemptions is the number of times the command was preempted
+	// by a command of higher priority and run again.
+	Preemptions int
+
+	// Err is the error returned by running the command, nil on success.
+	Err error
+
+	// ExitCode is the exit code of the command, or -1 if it did not
+	// exit or was not started.
+	ExitCode int
+
+	// Stdout and Stderr hold the captured output if Batch.Capture is
+	// set, and are nil otherwise.
+	Stdout []byte
+	Stderr []byte
+
+	// Replayed reports whether the result was returned from a KeyStore
+	// instead of running the command.
+	Replayed bool
+
+	// Artifacts lists the files holding the output of the command, if
+	// Batch.ArtifactDir is set.
+	Artifacts []Artifact
+
+	// Change describes how the output changed since the previous
+	// successful run, if Batch.CompareOutput is set.
+	Change *Change
+
+	// CoverDir is the GOCOVERDIR of the command, if Batch.CoverDir is
+	// set.
+	CoverDir string
+}
+
+// Duration returns how long the command ran.
+func (r *Result) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// String returns a one line report of the result, in the style of go test.
+func (r *Result) String() string {
+	d := r.Duration().Seconds()
+	switch r.Status {
+	case StatusOK:
+		return fmt.Sprintf("ok  \t%s\t%.3fs", r.Cmd.name(), d)
+	case StatusFailed:
+		return fmt.Sprintf("FAIL\t%s\t%.3fs\t%v", r.Cmd.name(), d, r.Err)
+	}
+	return fmt.Sprintf("SKIP\t%s\t%s", r.Cmd.name(), r.Status)
+}
+
+// WriteReport writes a report of results to w: a line per result, as
+// returned by Result.String, followed by its artifacts and the changes
+// in its output.
+func WriteReport(w io.Writer, results []*Result) error {
+	var buf bytes.Buffer
+	for _, r := range results {
+		fmt.Fprintln(&buf, r)
+		for _, a := range r.Artifacts {
+			fmt.Fprintf(&buf, "    %s: %s (%d bytes, sha256 %s)\n", a.Stream, a.Path, a.Size, a.SHA256)
+		}
+		ch := r.Change
+		if ch == nil {
+			continue
+		}
+		if ch.ExitCode != ch.PrevExitCode {
+			fmt.Fprintf(&buf, "    exit code changed from %d to %d\n", ch.PrevExitCode, ch.ExitCode)
+		}
+		for _, l := range strings.SplitAfter(ch.Diff, "\n") {
+			if l != "" {
+				fmt.Fprintf(&buf, "    %s", l)
+			}
+		}
+		for _, l := range ch.NewStderr {
+			fmt.Fprintf(&buf, "    new stderr: %s\n", l)
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Run runs the commands of the batch concurrently and waits for them
+// to finish. It returns the results in the order of b.Cmds and the
+// first error.
+func (b *Batch) Run(ctx context.Context) ([]*Result, error) {
+	results, _, err := b.RunSummary(ctx)
+	return results, err
+}
+
+// RunSummary runs the batch like Run, and also returns the Summary of
+// the run, as sent to the Notifiers. The results and the Summary are
+// nil only if the batch could not be set up, because of an invalid
+// timeout, artifact name, stream or trigger.
+//
+// A Batch is not modified by its runs, so it can be run again, or by
+// several goroutines at once.
+func (b *Batch) RunSummary(ctx context.Context) ([]*Result, *Summary, error) {
+	run := *b
+	b = &run
+	b.DebugOutput = shareWriter(b.DebugOutput)
+	ts, err := b.timeouts()
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.ArtifactDir != "" {
+		if err := b.checkArtifacts(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if b.RunID == "" {
+		b.RunID = newRunID()
+	}
+	seed := b.Seed
+	if b.Shuffle && seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	cmds := b.Cmds
+	b.wires = nil
+	if len(b.Streams) > 0 {
+		if b.Pool != nil {
+			return nil, nil, errStreamPool
+		}
+		if cmds, b.wires, err = connect(b.Cmds, b.Streams); err != nil {
+			return nil, nil, err
+		}
+		defer b.wires.closeAll()
+	}
+	parent, start := ctx, time.Now()
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	stop, err := b.watchTriggers(ctx, abort)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer stop()
+	b.cpu = nil
+	if b.CPUBudget > 0 {
+		b.cpu = &cpuMeter{budget: b.CPUBudget, abort: abort}
+		defer b.cpu.watch(b.CPUSampleInterval)()
+	}
+	eg := new(errgroup.Group)
+	if b.FailFast {
+		eg, ctx = errgroup.WithContext(ctx)
+	}
+	var sem chan struct{}
+	if b.Parallel > 0 {
+		sem = make(chan struct{}, b.Parallel)
+	}
+
+	results := make([]*Result, len(cmds))
+	// take takes a Parallel and a Pool slot for c, freed by release. It
+	// returns the result of c instead if c cannot run.
+	take := func(c *Cmd) (tk *ticket, release func(), r *Result) {
+		// Connected commands must run at the same time, so they take no
+		// Parallel slot. There are none with a Pool.
+		limited := b.wires[c] == nil
+		held := false
+		release = func() {
+			if held {
+				<-sem
+			}
+		}
+		if ctx.Err() == nil && sem != nil && limited {
+			select {
+			case sem <- struct{}{}:
+				held = true
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			release()
+			return nil, nil, &Result{Cmd: c, Status: StatusCanceled, ExitCode: -1, Err: context.Cause(ctx)}
+		}
+		if b.SkipMissed && b.missed(c) {
+			release()
+			return nil, nil, &Result{Cmd: c, Status: StatusDeadlineMissed, ExitCode: -1, Err: ErrDeadlineMissed}
+		}
+		if b.Pool != nil {
+			var err error
+			if tk, err = b.Pool.enqueue(b.Tenant, c); err != nil {
+				release()
+				return nil, nil, &Result{Cmd: c, Status: StatusRejected, ExitCode: -1, Err: err}
+			}
+		}
+		return tk, release, nil
+	}
+	launch := func(i int, c *Cmd, tk *ticket, release func()) error {
+		defer release()
+		defer b.wires.close(c)
+		r := b.runOne(ctx, c, ts.apply(c.Timeout), tk)
+		results[i] = r
+		return r.Err
+	}
+	for _, i := range b.order(seed) {
+		i, c := i, cmds[i]
+		if c.Gate && ctx.Err() == nil {
+			// Gated commands take no slot while waiting for approval.
+			eg.Go(func() error {
+				if r := b.approve(ctx, c); r != nil {
+					results[i] = r
+					b.wires.close(c)
+					return r.Err
+				}
+				tk, release, r := take(c)
+				if r != nil {
+					results[i] = r
+					b.wires.close(c)
+					return nil
+				}
+				return launch(i, c, tk, release)
+			})
+			continue
+		}
+		tk, release, r := take(c)
+		if r != nil {
+			results[i] = r
+			b.wires.close(c)
+			continue
+		}
+		eg.Go(func() error {
+			return launch(i, c, tk, release)
+		})
+	}
+	err = eg.Wait()
+	for i, r := range results {
+		r.Cmd = b.Cmds[i]
+		if err == nil && r.Err != nil {
+			err = r.Err
+		}
+	}
+	s := NewSummary(b.RunID, start, results)
+	if b.Shuffle {
+		s.Seed = seed
+	}
+	if b.CoverDir != "" {
+		var cerr error
+		if s.CoverProfile, cerr = b.mergeCoverage(parent, results); err == nil {
+			err = cerr
+		}
+	}
+	for _, n := range b.Notifiers {
+		if nerr := n.Notify(parent, s); err == nil {
+			err = nerr
+		}
+	}
+	return results, s, err
+}
+
+// order returns the indexes of b.Cmds in the order they are started,
+// shuffled with seed if b.Shuffle is set.
+func (b *Batch) order(seed int64) []int {
+	idx := make([]int, len(b.Cmds))
+	for i := range idx {
+		idx[i] = i
+	}
+	if b.Shuffle {
+		r := rand.New(rand.NewSource(seed))
+		r.Shuffle(len(idx), func(i, j int) {
+			idx[i], idx[j] = idx[j], idx[i]
+		})
+	}
+	if b.EarliestDeadlineFirst {
+		sort.SliceStable(idx, func(i, j int) bool {
+			di, dj := b.Cmds[idx[i]].Deadline, b.Cmds[idx[j]].Deadline
+			return !di.IsZero() && (dj.IsZero() || di.Before(dj))
+		})
+	}
+	return idx
+}
+
+// missed reports whether c cannot finish before its deadline if
+// started now.
+func (b *Batch) missed(c *Cmd) bool {
+	if c.Deadline.IsZero() {
+		return false
+	}
+	var d time.Duration
+	if b.History != nil {
+		d, _ = b.History.Duration(c.name())
+	}
+	return time.Now().Add(d).After(c.Deadline)
+}
+
+// runOne runs c in the slot of tk, if not nil, unless it is replayed
+// from b.Keys.
+func (b *Batch) runOne(ctx context.Context, c *Cmd, timeout time.Duration, tk *ticket) (r *Result) {
+	if b.Keys != nil && c.IdempotencyKey != "" {
+		// Give up the Pool slot while another command holds the key, as
+		// that command may be waiting for the slot.
+		yielded := false
+		r = b.Keys.acquire(ctx, c, func() {
+			if tk != nil {
+				tk.abandon()
+				yielded = true
+			}
+		})
+		if r != nil {
+			if tk != nil && !yielded {
+				tk.abandon()
+			}
+			return r
+		}
+		defer func() {
+			b.Keys.release(c.IdempotencyKey, r)
+		}()
+		if yielded {
+			var err error
+			if tk, err = b.Pool.enqueue(b.Tenant, c); err != nil {
+				return &Result{Cmd: c, Status: StatusRejected, ExitCode: -1, Err: err}
+			}
+		}
+	}
+	if tk != nil {
+		r = b.runPooled(ctx, c, timeout, tk)
+	} else {
+		r, _ = b.run(ctx, c, timeout, nil)
+	}
+	if b.History != nil && r.Status != StatusCanceled {
+		if b.CompareOutput {
+			r.Change, _ = b.History.Compare(r, b.Normalize)
+		}
+		b.History.Record(r)
+	}
+	return r
+}
+
+// runPooled runs c in a slot of the Pool of tk, running it again each
+// time it is preempted.
+func (b *Batch) runPooled(ctx context.Context, c *Cmd, timeout time.Duration, tk *ticket) *Result {
+	for n := 0; ; n++ {
+		if err := tk.wait(ctx); err != nil {
+			return &Result{Cmd: c, Status: StatusCanceled, ExitCode: -1, Err: err, Preemptions: n}
+		}
+		r, interrupted := b.run(ctx, c, timeout, tk.stop)
+		tk.release()
+		if !interrupted {
+			r.Preemptions = n
+			return r
+		}
+		tk.requeue()
+	}
+}
+
+// run runs c. If stop is closed while c is running, c is sent SIGTERM
+// and killed if it has not exited after the grace period of the Pool,
+// 10 seconds if there is none. run reports whether c was interrupted
+// this way, rather than having exited before.
+func (b *Batch) run(ctx context.Context, c *Cmd, timeout time.Duration, stop <-chan struct{}) (r *Result, interrupted bool) {
+	r = &Result{Cmd: c, RunID: b.RunID, Timeout: timeout}
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if !c.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.Deadline)
+		defer cancel()
+	}
+	if stop != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	if stop != nil {
+		cmd.Cancel = func() error {
+			select {
+			case <-stop:
+				err := cmd.Process.Signal(syscall.SIGTERM)
+				interrupted = err == nil
+				return err
+			default:
+				return cmd.Process.Kill()
+			}
+		}
+		cmd.WaitDelay = b.Pool.gracePeriod()
+	}
+	cmd.Dir = c.Dir
+	cmd.Env = b.env(ctx, c)
+	if b.CoverDir != "" {
+		if r.CoverDir, r.Err = b.coverDir(c); r.Err != nil {
+			r.Status, r.ExitCode = StatusFailed, -1
+			return r, false
+		}
+		cmd.Env = append(cmd.Env, "GOCOVERDIR="+r.CoverDir)
+	}
+	if b.DebugOutput != nil {
+		b.writeDebug(ctx, cmd, c, timeout)
+	}
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	cmd.Stdin = c.Stdin
+	cmd.ExtraFiles = c.ExtraFiles
+
+	var stdout, stderr bytes.Buffer
+	if b.Capture || b.ArtifactDir != "" {
+		if c.Stdout != nil && c.Stdout == c.Stderr {
+			w := &syncWriter{w: c.Stdout}
+			cmd.Stdout, cmd.Stderr = w, w
+		}
+	}
+	if b.Capture {
+		cmd.Stdout, cmd.Stderr = tee(cmd.Stdout, &stdout), tee(cmd.Stderr, &stderr)
+	}
+	var artifacts []*artifact
+	if b.ArtifactDir != "" {
+		if artifacts, r.Err = b.createArtifacts(c); r.Err != nil {
+			r.Status, r.ExitCode = StatusFailed, -1
+			return r, false
+		}
+		cmd.Stdout, cmd.Stderr = tee(cmd.Stdout, artifacts[0]), tee(cmd.Stderr, artifacts[1])
+	}
+
+	r.Start = time.Now()
+	if r.Err = cmd.Start(); r.Err == nil {
+		b.cpu.start(cmd.Process.Pid)
+		b.wires.started(c)
+		r.Err = cmd.Wait()
+	}
+	r.End = time.Now()
+	r.ExitCode = -1
+	if ps := cmd.ProcessState; ps != nil {
+		r.ExitCode = ps.ExitCode()
+		r.CPUTime = ps.UserTime() + ps.SystemTime()
+		b.cpu.done(cmd.Process.Pid, r.CPUTime)
+	}
+	if r.Err != nil {
+		r.Status = StatusFailed
+		// Tell why the command was killed, such as ErrCPUBudget.
+		if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+			r.Err = fmt.Errorf("%w: %v", cause, r.Err)
+		}
+	}
+	if b.Capture {
+		r.Stdout = append([]byte{}, stdout.Bytes()...)
+		r.Stderr = append([]byte{}, stderr.Bytes()...)
+	}
+	for _, a := range artifacts {
+		if err := a.close(); err != nil && r.Err == nil {
+			r.Err, r.Status = err, StatusFailed
+		}
+		r.Artifacts = append(r.Artifacts, a.Artifact)
+	}
+	return r, interrupted
+}
+
+// name returns the label of the command, or its path if it has none.
+func (c *Cmd) name() string {
+	if c.Label != "" {
+		return c.Label
+	}
+	return c.Path
+}
+
+func tee(w, dup io.Writer) io.Writer {
+	if w == nil {
+		return dup
+	}
+	return io.MultiWriter(w, dup)
+}
+
+// syncWriter serializes writes to w, which is shared by Stdout and Stderr.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,177 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// ErrOperatorCancel is the cause of the cancellation of a batch by one
+// of its Batch.CancelTriggers. It is wrapped with the reason given.
+var ErrOperatorCancel = errors.New("command: canceled by operator")
+
+// CancelTrigger lets an operator cancel a running batch from outside
+// the process, the batch being aborted as on a FailFast failure.
+type CancelTrigger interface {
+	// Watch arms the trigger and returns. Until ctx is done, the trigger
+	// then calls cancel, with the reason, when it fires. The returned
+	// function waits for the trigger to be disarmed once ctx is done.
+	// Watch returns an error if the trigger cannot be armed.
+	Watch(ctx context.Context, cancel func(reason string)) (wait func(), err error)
+}
+
+// watchTriggers arms the triggers of b, which abort the batch with
+// ErrOperatorCancel when they fire. It returns a function disarming
+// them, or an error if one cannot be armed.
+func (b *Batch) watchTriggers(ctx context.Context, abort context.CancelCauseFunc) (stop func(), err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	var waits []func()
+	stop = func() {
+		cancel()
+		for _, wait := range waits {
+			wait()
+		}
+	}
+	for _, t := range b.CancelTriggers {
+		wait, err := t.Watch(ctx, func(reason string) {
+			abort(fmt.Errorf("%w: %s", ErrOperatorCancel, reason))
+		})
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("command: cancel trigger: %w", err)
+		}
+		waits = append(waits, wait)
+	}
+	return stop, nil
+}
+
+// watch runs f in a goroutine and returns a function waiting for it.
+func watch(f func()) (wait func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	return func() { <-done }
+}
+
+// SentinelFile cancels the batch when the file Path appears. Its
+// content, if any, is the reason. The file is removed once it fired,
+// so that it does not cancel the next batch.
+type SentinelFile struct {
+	Path string
+
+	// Poll is the interval between checks, 1 second if zero.
+	Poll time.Duration
+}
+
+// Watch implements CancelTrigger.
+func (s *SentinelFile) Watch(ctx context.Context, cancel func(reason string)) (func(), error) {
+	poll := s.Poll
+	if poll == 0 {
+		poll = time.Second
+	}
+	return watch(func() {
+		t := time.NewTicker(poll)
+		defer t.Stop()
+		for {
+			if data, err := os.ReadFile(s.Path); err == nil {
+				os.Remove(s.Path)
+				reason := strings.TrimSpace(string(data))
+				if reason == "" {
+					reason = "sentinel file " + s.Path
+				}
+				cancel(reason)
+				return
+			}
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}), nil
+}
+
+// SocketTrigger cancels the batch when the line "cancel", optionally
+// followed by a reason, is sent to the unix socket Path, such as with
+//
+//	echo cancel disk full | nc -U /run/batch.sock
+//
+// The socket is created when the batch starts, replacing a stale socket
+// but no other file, and removed when it ends.
+type SocketTrigger struct {
+	Path string
+}
+
+// Watch implements CancelTrigger.
+func (s *SocketTrigger) Watch(ctx context.Context, cancel func(reason string)) (func(), error) {
+	if fi, err := os.Lstat(s.Path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(s.Path)
+	}
+	ln, err := net.Listen("unix", s.Path)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	return watch(func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				line, _ := bufio.NewReader(conn).ReadString('\n')
+				fields := strings.Fields(line)
+				if len(fields) == 0 || fields[0] != "cancel" {
+					fmt.Fprintln(conn, "unknown command")
+					return
+				}
+				reason := strings.Join(fields[1:], " ")
+				if reason == "" {
+					reason = "socket " + s.Path
+				}
+				cancel(reason)
+				fmt.Fprintln(conn, "ok")
+			}()
+		}
+	}), nil
+}
+
+// SignalTrigger cancels the batch when the process receives Signal,
+// SIGUSR1 if nil. SIGUSR1 is only available on Unix systems.
+type SignalTrigger struct {
+	Signal os.Signal
+}
+
+// Watch implements CancelTrigger.
+func (s *SignalTrigger) Watch(ctx context.Context, cancel func(reason string)) (func(), error) {
+	sig := s.Signal
+	if sig == nil {
+		sig = defaultCancelSignal
+	}
+	if sig == nil {
+		return nil, errors.New("no signal to watch")
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig)
+	return watch(func() {
+		defer signal.Stop(ch)
+		select {
+		case got := <-ch:
+			cancel("signal " + got.String())
+		case <-ctx.Done():
+		}
+	}), nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package command
+
+import "os"
+
+// There is no SIGUSR1 outside Unix.
+var defaultCancelSignal os.Signal
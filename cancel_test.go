@@ -0,0 +1,95 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSentinelFile(t *testing.T) {
+	sentinel := filepath.Join(t.TempDir(), "stop")
+	b := &Batch{
+		Cmds:           []*Cmd{NewCmd("sleep", 0, "5")},
+		CancelTriggers: []CancelTrigger{&SentinelFile{Path: sentinel, Poll: 5 * time.Millisecond}},
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		os.WriteFile(sentinel, []byte("maintenance\n"), 0644)
+	}()
+	_, err := b.Run(context.Background())
+	if !errors.Is(err, ErrOperatorCancel) || !strings.Contains(err.Error(), "maintenance") {
+		t.Errorf("err = %v, want ErrOperatorCancel with reason", err)
+	}
+}
+
+func TestSocketTrigger(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "batch.sock")
+	b := &Batch{
+		Cmds:           []*Cmd{NewCmd("sleep", 0, "5")},
+		CancelTriggers: []CancelTrigger{&SocketTrigger{Path: sock}},
+	}
+	reply := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := net.Dial("unix", sock)
+			if err != nil {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			defer conn.Close()
+			fmt.Fprintln(conn, "cancel disk full")
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			reply <- line
+			return
+		}
+	}()
+	_, err := b.Run(context.Background())
+	if !errors.Is(err, ErrOperatorCancel) || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("err = %v, want ErrOperatorCancel with reason", err)
+	}
+	if got := <-reply; got != "ok\n" {
+		t.Errorf("reply %q, want %q", got, "ok\n")
+	}
+	if _, err := os.Stat(sock); err == nil {
+		t.Error("socket not removed")
+	}
+}
+
+func TestCancelTriggerErrors(t *testing.T) {
+	dir := t.TempDir()
+	// A regular file in the place of the socket is kept.
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, []byte("data"), 0644)
+	b := &Batch{
+		Cmds:           []*Cmd{NewCmd("true", 0)},
+		CancelTriggers: []CancelTrigger{&SocketTrigger{Path: file}},
+	}
+	if _, err := b.Run(context.Background()); err == nil {
+		t.Error("socket over a file: no error")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "data" {
+		t.Error("file replaced by socket")
+	}
+
+	// A sentinel fires once.
+	sentinel := filepath.Join(dir, "stop")
+	os.WriteFile(sentinel, nil, 0644)
+	b = &Batch{
+		Cmds:           []*Cmd{NewCmd("sleep", 0, "5")},
+		CancelTriggers: []CancelTrigger{&SentinelFile{Path: sentinel, Poll: time.Millisecond}},
+	}
+	if _, err := b.Run(context.Background()); !errors.Is(err, ErrOperatorCancel) {
+		t.Fatalf("err = %v, want ErrOperatorCancel", err)
+	}
+	b.Cmds = []*Cmd{NewCmd("true", 0)}
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Errorf("next run: %v", err)
+	}
+}
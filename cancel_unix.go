@@ -0,0 +1,10 @@
+//go:build unix
+
+package command
+
+import (
+	"os"
+	"syscall"
+)
+
+var defaultCancelSignal os.Signal = syscall.SIGUSR1
@@ -3,6 +3,7 @@ package command
 import (
 	"context"
 	"io"
+	"os"
 	"os/exec"
 	"time"
 
@@ -14,6 +15,10 @@ import (
 // A Cmd cannot be reused after calling its Run, Output or CombinedOutput
 // methods.
 type Cmd struct {
+	// Label names the command in results and reports.
+	// If Label is empty, Path is used.
+	Label string
+
 	// Path is the path of the command to run.
 	//
 	// This is the only field that must be set to a non-zero
@@ -72,8 +77,41 @@ type Cmd struct {
 	Stdout io.Writer
 	Stderr io.Writer
 
+	// ExtraFiles specifies additional open files to be inherited by the
+	// new process. It does not include standard input, standard output, or
+	// standard error. If non-nil, entry i becomes file descriptor 3+i.
+	ExtraFiles []*os.File
+
 	// Timeout
 	Timeout time.Duration
+
+	// Deadline is the time by which the command must have finished.
+	// The command is killed if it is still running at the deadline.
+	// The zero value means no deadline.
+	Deadline time.Time
+
+	// Priority orders the commands waiting for a slot of a Pool:
+	// higher priorities go first.
+	Priority int
+
+	// Preemptible allows a Pool to stop the command and run it again
+	// later, to give its slot to a command of higher priority.
+	// See Pool.Preempt.
+	Preemptible bool
+
+	// Gate requires the command to be approved by the Approver of the
+	// Batch before it starts.
+	Gate bool
+
+	// IdempotencyKey identifies the job done by the command. Once a
+	// command with the key succeeded, commands with the same key are not
+	// run again; see Batch.Keys.
+	IdempotencyKey string
+
+	// Inputs lists the slash-separated glob patterns of the files,
+	// relative to the repository root, that the command depends on.
+	// "**" matches any number of directories. See Affected.
+	Inputs []string
 }
 
 // ConcurrenceComE concurrence run command
@@ -87,16 +125,11 @@ func ConcurrenceComE(ctx context.Context, cmds ...*Cmd) error {
 			cancelC context.CancelFunc
 		)
 		if c.Timeout != 0 {
-			ctxC, cancelC = context.WithTimeout(ctx, c.Timeout)
+			ctxC, cancelC = withTimeout(ctx, c.Timeout)
 		}
-		cmd := exec.CommandContext(ctxC, c.Path, c.Args...)
-		cmd.Dir = c.Dir
-		cmd.Env = c.Env
-		cmd.Stdout = c.Stdout
-		cmd.Stderr = c.Stderr
-		cmd.Stdin = c.Stdin
+		c := c
 		eg.Go(func() (err error) {
-			err = cmd.Run()
+			err = execCmd(ctxC, c)
 			if cancelC != nil {
 				cancelC()
 			}
@@ -116,18 +149,13 @@ func ConcurrenceComNE(ctx context.Context, cmds ...*Cmd) error {
 			cancelC context.CancelFunc
 		)
 		if c.Timeout != 0 {
-			ctxC, cancelC = context.WithTimeout(ctx, c.Timeout)
+			ctxC, cancelC = withTimeout(ctx, c.Timeout)
 		} else {
 			ctxC, cancelC = context.WithCancel(ctx)
 		}
-		cmd := exec.CommandContext(ctxC, c.Path, c.Args...)
-		cmd.Dir = c.Dir
-		cmd.Env = c.Env
-		cmd.Stdout = c.Stdout
-		cmd.Stderr = c.Stderr
-		cmd.Stdin = c.Stdin
+		c := c
 		eg.Go(func() (err error) {
-			err = cmd.Run()
+			err = execCmd(ctxC, c)
 			cancelC()
 			return
 		})
@@ -135,6 +163,23 @@ func ConcurrenceComNE(ctx context.Context, cmds ...*Cmd) error {
 	return eg.Wait()
 }
 
+// withTimeout and execCmd are the clock and the executor of
+// ConcurrenceComE and ConcurrenceComNE, replaced in tests.
+var (
+	withTimeout = context.WithTimeout
+
+	// execCmd runs c until it exits, killing it once ctx is done.
+	execCmd = func(ctx context.Context, c *Cmd) error {
+		cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+		cmd.Dir = c.Dir
+		cmd.Env = c.Env
+		cmd.Stdout = c.Stdout
+		cmd.Stderr = c.Stderr
+		cmd.Stdin = c.Stdin
+		return cmd.Run()
+	}
+)
+
 func NewCmd(name string, timeout time.Duration, args ...string) *Cmd {
 	return &Cmd{
 		Path:    name,
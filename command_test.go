@@ -2,13 +2,19 @@ package command
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestConcurrenceComE(t *testing.T) {
-	err := ConcurrenceComNE(context.Background(),
-		NewCmd("ls", 0,"-al"),
-		NewCmd("lsss", 0,"-al"),
+	err := ConcurrenceComE(context.Background(),
+		NewCmd("ls", 0, "-al"),
+		NewCmd("lsss", 0, "-al"),
 	)
 	if err == nil {
 		t.Error("err should not be empty")
@@ -17,10 +23,286 @@ func TestConcurrenceComE(t *testing.T) {
 
 func TestConcurrenceComNE(t *testing.T) {
 	err := ConcurrenceComNE(context.Background(),
-		NewCmd("ls", 0,"-al"),
-		NewCmd("lsss", 0,"-al"),
-		)
+		NewCmd("ls", 0, "-al"),
+		NewCmd("lsss", 0, "-al"),
+	)
 	if err == nil {
 		t.Error("err should not be empty")
 	}
-}
\ No newline at end of file
+}
+
+// fakeClock is a clock advanced by the test, replacing withTimeout.
+type fakeClock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at   time.Duration
+	fire func()
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// afterFunc calls f once the clock advanced by d. stop cancels the call.
+func (c *fakeClock) afterFunc(d time.Duration, f func()) (stop func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now + d, fire: f}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, u := range c.timers {
+			if u == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				c.cond.Broadcast()
+				return
+			}
+		}
+	}
+}
+
+func (c *fakeClock) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := c.afterFunc(d, func() { cancel(context.DeadlineExceeded) })
+	return ctx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
+
+// waitPending waits until n timers are pending.
+func (c *fakeClock) waitPending(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) != n {
+		c.cond.Wait()
+	}
+}
+
+func (c *fakeClock) time() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// advance advances the clock by d, firing the timers due in order.
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now + d
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at < c.timers[j].at })
+		if len(c.timers) == 0 || c.timers[0].at > end {
+			break
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.at
+		c.mu.Unlock()
+		t.fire()
+		c.mu.Lock()
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// fakeExec is an executor running commands for a fake duration,
+// given by their Path, and failing with the error set for their label.
+type fakeExec struct {
+	clock *fakeClock
+	errs  map[string]error
+
+	mu      sync.Mutex
+	events  []fakeEvent
+	running int
+	max     int
+}
+
+// fakeEvent is the exit of a command run by a fakeExec.
+type fakeEvent struct {
+	at     time.Duration
+	label  string
+	killed bool
+	err    error
+}
+
+func (ev fakeEvent) String() string {
+	if ev.killed {
+		return fmt.Sprintf("%v: %s killed", ev.at, ev.label)
+	}
+	return fmt.Sprintf("%v: %s exited: %v", ev.at, ev.label, ev.err)
+}
+
+func (e *fakeExec) exec(ctx context.Context, c *Cmd) error {
+	d, err := time.ParseDuration(c.Path)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.running++
+	if e.running > e.max {
+		e.max = e.running
+	}
+	e.mu.Unlock()
+
+	done := make(chan struct{})
+	ev := fakeEvent{label: c.Label, at: e.clock.time() + d}
+	stop := e.clock.afterFunc(d, func() { close(done) })
+	select {
+	case <-done:
+		ev.err = e.errs[c.Label]
+	case <-ctx.Done():
+		// The clock does not advance until the timer is stopped.
+		ev.at, ev.killed, ev.err = e.clock.time(), true, errKilled
+		stop()
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.running--
+	e.events = append(e.events, ev)
+	return ev.err
+}
+
+// log returns the events in time order, the exits of commands before the
+// kills they caused.
+func (e *fakeExec) log() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	evs := append([]fakeEvent(nil), e.events...)
+	sort.Slice(evs, func(i, j int) bool {
+		a, b := evs[i], evs[j]
+		if a.at != b.at {
+			return a.at < b.at
+		}
+		if a.killed != b.killed {
+			return !a.killed
+		}
+		return a.label < b.label
+	})
+	var log []string
+	for _, ev := range evs {
+		log = append(log, ev.String())
+	}
+	return log
+}
+
+// fake replaces the clock and executor of the runners for the test.
+func fake(t *testing.T, errs map[string]error) *fakeExec {
+	clock := newFakeClock()
+	e := &fakeExec{clock: clock, errs: errs}
+	oldTimeout, oldExec := withTimeout, execCmd
+	withTimeout, execCmd = clock.withTimeout, e.exec
+	t.Cleanup(func() { withTimeout, execCmd = oldTimeout, oldExec })
+	return e
+}
+
+// fakeCmd returns a command labelled label running for d.
+func fakeCmd(label string, d, timeout time.Duration) *Cmd {
+	return &Cmd{Label: label, Path: d.String(), Timeout: timeout}
+}
+
+var (
+	errFake = errors.New("fake failure")
+
+	// errKilled is the error of a killed command, as returned by the
+	// real executor.
+	errKilled = errors.New("signal: killed")
+)
+
+func TestConcurrenceFake(t *testing.T) {
+	runners := []struct {
+		name string
+		run  func(context.Context, ...*Cmd) error
+	}{
+		{"ComE", ConcurrenceComE},
+		{"ComNE", ConcurrenceComNE},
+	}
+	// step advances the clock, or cancels the context, then waits for
+	// the given number of timers to be pending.
+	type step struct {
+		advance time.Duration
+		cancel  bool
+		pending int
+	}
+	tests := []struct {
+		name  string
+		cmds  []*Cmd
+		errs  map[string]error
+		steps []step
+		err   error
+		log   []string
+	}{
+		{
+			name:  "success",
+			cmds:  []*Cmd{fakeCmd("a", 2*time.Second, 0), fakeCmd("b", time.Second, 0)},
+			steps: []step{{pending: 2}, {advance: time.Second, pending: 1}, {advance: time.Second}},
+			log:   []string{"1s: b exited: <nil>", "2s: a exited: <nil>"},
+		},
+		{
+			name:  "timeout",
+			cmds:  []*Cmd{fakeCmd("a", 5*time.Second, 3*time.Second), fakeCmd("b", 4*time.Second, 0)},
+			steps: []step{{pending: 3}, {advance: 3 * time.Second}},
+			err:   errKilled,
+			log:   []string{"3s: a killed", "3s: b killed"},
+		},
+		{
+			name:  "timeout not reached",
+			cmds:  []*Cmd{fakeCmd("a", time.Second, 3*time.Second)},
+			steps: []step{{pending: 2}, {advance: time.Second}},
+			log:   []string{"1s: a exited: <nil>"},
+		},
+		{
+			name:  "fail fast",
+			cmds:  []*Cmd{fakeCmd("a", 3*time.Second, 0), fakeCmd("b", time.Second, 0), fakeCmd("c", 2*time.Second, 0)},
+			errs:  map[string]error{"b": errFake, "c": errors.New("later failure")},
+			steps: []step{{pending: 3}, {advance: time.Second}},
+			err:   errFake,
+			log:   []string{"1s: b exited: fake failure", "1s: a killed", "1s: c killed"},
+		},
+		{
+			name:  "cancel",
+			cmds:  []*Cmd{fakeCmd("a", 3*time.Second, 0), fakeCmd("b", 3*time.Second, 5*time.Second)},
+			steps: []step{{pending: 3}, {advance: time.Second, pending: 3}, {cancel: true}},
+			err:   errKilled,
+			log:   []string{"1s: a killed", "1s: b killed"},
+		},
+	}
+	for _, r := range runners {
+		for _, tt := range tests {
+			t.Run(r.name+"/"+tt.name, func(t *testing.T) {
+				e := fake(t, tt.errs)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				errc := make(chan error)
+				go func() { errc <- r.run(ctx, tt.cmds...) }()
+
+				for _, s := range tt.steps {
+					if s.cancel {
+						cancel()
+					}
+					e.clock.advance(s.advance)
+					e.clock.waitPending(s.pending)
+				}
+				err := <-errc
+				if !errors.Is(err, tt.err) || (err == nil) != (tt.err == nil) {
+					t.Errorf("err = %v, want %v", err, tt.err)
+				}
+				if log := e.log(); !reflect.DeepEqual(log, tt.log) {
+					t.Errorf("log\n%q\nwant\n%q", log, tt.log)
+				}
+				if e.max != len(tt.cmds) {
+					t.Errorf("%d commands ran at once, want all %d", e.max, len(tt.cmds))
+				}
+			})
+		}
+	}
+}
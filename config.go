@@ -0,0 +1,227 @@
+package command
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the defaults of a Batch, loaded by LoadConfig from
+// layered sources.
+type Config struct {
+	Parallel     int
+	FailFast     bool
+	TimeoutScale float64
+	MinTimeout   time.Duration
+	MaxTimeout   time.Duration
+
+	// Origin maps each key to the source of its value: "default", the
+	// path of a config file, the name of an environment variable, or
+	// "flag".
+	Origin map[string]string
+}
+
+// configKeys lists the keys of a Config, in the order they are printed.
+// Their setters are the only parsers of the values, from config files,
+// flags or the environment, including for Batch.timeouts.
+var configKeys = []struct {
+	name   string
+	set    func(c *Config, v string) error
+	get    func(c *Config) string
+	isBool bool
+}{
+	{"parallel",
+		func(c *Config, v string) (err error) { c.Parallel, err = strconv.Atoi(v); return },
+		func(c *Config) string { return strconv.Itoa(c.Parallel) },
+		false},
+	{"fail-fast",
+		func(c *Config, v string) (err error) { c.FailFast, err = strconv.ParseBool(v); return },
+		func(c *Config) string { return strconv.FormatBool(c.FailFast) },
+		true},
+	{"timeout-scale",
+		func(c *Config, v string) (err error) {
+			if c.TimeoutScale, err = strconv.ParseFloat(v, 64); err == nil && c.TimeoutScale <= 0 {
+				err = errors.New("not positive")
+			}
+			return
+		},
+		func(c *Config) string { return strconv.FormatFloat(c.TimeoutScale, 'g', -1, 64) },
+		false},
+	{"timeout-min",
+		func(c *Config, v string) error { return parseTimeout(&c.MinTimeout, v) },
+		func(c *Config) string { return c.MinTimeout.String() },
+		false},
+	{"timeout-max",
+		func(c *Config, v string) error { return parseTimeout(&c.MaxTimeout, v) },
+		func(c *Config) string { return c.MaxTimeout.String() },
+		false},
+}
+
+func parseTimeout(d *time.Duration, v string) (err error) {
+	if *d, err = time.ParseDuration(v); err == nil && *d < 0 {
+		err = errors.New("negative")
+	}
+	return err
+}
+
+// configEnv returns the environment variable of key.
+func configEnv(key string) string {
+	return "COMMAND_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// setEnv sets the keys from their environment variable, if not empty.
+func (c *Config) setEnv(keys ...string) error {
+	for _, key := range keys {
+		env := configEnv(key)
+		if v := os.Getenv(env); v != "" {
+			if err := c.Set(key, v, env); err != nil {
+				return fmt.Errorf("%s: %v", env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ProjectConfig is the name of the project config file.
+const ProjectConfig = ".command.conf"
+
+// LoadConfig loads the config from, in increasing order of precedence:
+// the built-in defaults, the user config file command/config in
+// os.UserConfigDir, the project config file ProjectConfig in dir, and
+// the environment variables COMMAND_<KEY>, such as COMMAND_FAIL_FAST
+// for the key fail-fast. Flags can then be added with Set or Flags.
+//
+// Config files hold lines of the form "key = value". Empty lines and
+// lines starting with "#" are ignored. Missing files are skipped.
+func LoadConfig(dir string) (*Config, error) {
+	c := &Config{Origin: make(map[string]string)}
+	for _, k := range configKeys {
+		c.Origin[k.name] = "default"
+	}
+	var files []string
+	if d, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(d, "command", "config"))
+	}
+	files = append(files, filepath.Join(dir, ProjectConfig))
+	for _, file := range files {
+		if err := c.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range configKeys {
+		if err := c.setEnv(k.name); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Config) loadFile(file string) error {
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return fmt.Errorf("%s:%d: missing =", file, n)
+		}
+		key, v := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if err := c.Set(key, v, file); err != nil {
+			return fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+	}
+	return s.Err()
+}
+
+// Set sets key to the value v, coming from origin.
+func (c *Config) Set(key, v, origin string) error {
+	for _, k := range configKeys {
+		if k.name == key {
+			if err := k.set(c, v); err != nil {
+				return fmt.Errorf("invalid %s %q", key, v)
+			}
+			if c.Origin == nil {
+				c.Origin = make(map[string]string)
+			}
+			c.Origin[key] = origin
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown config key %q", key)
+}
+
+// Flags defines a flag in fs for each key, setting it with origin
+// "flag". Boolean keys can be set by their bare flag, as -fail-fast.
+func (c *Config) Flags(fs *flag.FlagSet) {
+	for _, k := range configKeys {
+		fs.Var(&configFlag{c: c, key: k.name, isBool: k.isBool}, k.name, "set "+k.name)
+	}
+}
+
+// configFlag is the flag of a key.
+type configFlag struct {
+	c      *Config
+	key    string
+	isBool bool
+}
+
+func (f *configFlag) String() string {
+	if f.c == nil {
+		return ""
+	}
+	for _, k := range configKeys {
+		if k.name == f.key {
+			return k.get(f.c)
+		}
+	}
+	return ""
+}
+
+func (f *configFlag) Set(v string) error { return f.c.Set(f.key, v, "flag") }
+
+func (f *configFlag) IsBoolFlag() bool { return f.isBool }
+
+// Apply sets the fields of b that are not set from c.
+func (c *Config) Apply(b *Batch) {
+	if b.Parallel == 0 {
+		b.Parallel = c.Parallel
+	}
+	b.FailFast = b.FailFast || c.FailFast
+	if b.TimeoutScale == 0 {
+		b.TimeoutScale = c.TimeoutScale
+	}
+	if b.MinTimeout == 0 {
+		b.MinTimeout = c.MinTimeout
+	}
+	if b.MaxTimeout == 0 {
+		b.MaxTimeout = c.MaxTimeout
+	}
+}
+
+// WriteTo writes the effective values of c and their origin to w, one
+// key per line.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+	for _, k := range configKeys {
+		fmt.Fprintf(&sb, "%-14s= %-8s # %s\n", k.name, k.get(c), c.Origin[k.name])
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
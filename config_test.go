@@ -0,0 +1,62 @@
+package command
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("HOME", home)
+	user, _ := os.UserConfigDir()
+	os.MkdirAll(filepath.Join(user, "command"), 0755)
+	os.WriteFile(filepath.Join(user, "command", "config"), []byte("parallel = 4\ntimeout-scale = 2\n"), 0644)
+	project := t.TempDir()
+	os.WriteFile(filepath.Join(project, ProjectConfig), []byte("# project\nparallel = 8\n"), 0644)
+	t.Setenv("COMMAND_FAIL_FAST", "true")
+
+	c, err := LoadConfig(project)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("command", flag.ContinueOnError)
+	c.Flags(fs)
+	if err := fs.Parse([]string{"-timeout-max", "1m", "-fail-fast"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Batch{}
+	c.Apply(b)
+	if b.Parallel != 8 || !b.FailFast || b.TimeoutScale != 2 || b.MaxTimeout != time.Minute {
+		t.Errorf("got %+v", b)
+	}
+	var sb strings.Builder
+	c.WriteTo(&sb)
+	for _, want := range []string{
+		"parallel      = 8        # " + filepath.Join(project, ProjectConfig),
+		"fail-fast     = true     # flag",
+		"timeout-scale = 2        # " + filepath.Join(user, "command", "config"),
+		"timeout-min   = 0s       # default",
+		"timeout-max   = 1m0s     # flag",
+	} {
+		if !strings.Contains(sb.String(), want+"\n") {
+			t.Errorf("missing %q in\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestConfigEnvInvalid(t *testing.T) {
+	t.Setenv("COMMAND_TIMEOUT_SCALE", "-1")
+	if _, err := LoadConfig(t.TempDir()); err == nil {
+		t.Error("LoadConfig: negative scale accepted")
+	}
+	if _, err := (&Batch{}).Run(context.Background()); err == nil {
+		t.Error("Run: negative scale accepted")
+	}
+}
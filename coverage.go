@@ -0,0 +1,49 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// coverDir creates the directory receiving the coverage data of c, for
+// Go programs built with -cover.
+func (b *Batch) coverDir(c *Cmd) (string, error) {
+	root := filepath.Join(b.CoverDir, b.RunID)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(root, url.PathEscape(c.name())+"-")
+}
+
+// mergeCoverage merges the coverage data of results into the text
+// profile coverage.out in the run directory of b.CoverDir, and returns
+// its path. It returns "" if no command wrote coverage data.
+func (b *Batch) mergeCoverage(ctx context.Context, results []*Result) (string, error) {
+	var dirs []string
+	for _, r := range results {
+		if r.CoverDir == "" {
+			continue
+		}
+		if entries, err := os.ReadDir(r.CoverDir); err == nil && len(entries) > 0 {
+			dirs = append(dirs, r.CoverDir)
+		}
+	}
+	if len(dirs) == 0 {
+		return "", nil
+	}
+	profile := filepath.Join(b.CoverDir, b.RunID, "coverage.out")
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", "tool", "covdata", "textfmt",
+		"-i="+strings.Join(dirs, ","), "-o="+profile)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("command: go tool covdata: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return profile, nil
+}
@@ -0,0 +1,80 @@
+package command
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a Go program")
+	}
+	src := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module cov\n\ngo 1.20\n",
+		"main.go": `package main
+
+import "os"
+
+func main() {
+	if len(os.Args) > 1 {
+		a()
+	} else {
+		b()
+	}
+}
+
+func a() { println("a") }
+
+func b() { println("b") }
+`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bin := filepath.Join(src, "cov")
+	build := exec.Command("go", "build", "-cover", "-o", bin, ".")
+	build.Dir = src
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	b := &Batch{
+		Cmds: []*Cmd{
+			{Label: "a", Path: bin, Args: []string{"x"}},
+			{Label: "b", Path: bin},
+			{Label: "sh", Path: "true"},
+		},
+		CoverDir: t.TempDir(),
+	}
+	results, s, err := b.RunSummary(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].CoverDir == "" || results[0].CoverDir == results[1].CoverDir {
+		t.Errorf("cover dirs %q and %q, want distinct", results[0].CoverDir, results[1].CoverDir)
+	}
+	if s.CoverProfile != filepath.Join(b.CoverDir, s.RunID, "coverage.out") {
+		t.Fatalf("CoverProfile = %q", s.CoverProfile)
+	}
+	data, err := os.ReadFile(s.CoverProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both a and b ran, in different commands.
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) < 4 {
+		t.Fatalf("profile:\n%s", data)
+	}
+	for _, line := range lines[1:] {
+		if strings.HasSuffix(line, " 0") {
+			t.Errorf("block not covered: %s", line)
+		}
+	}
+}
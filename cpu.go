@@ -0,0 +1,87 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCPUBudget is the cause of the cancellation of a batch that
+// exceeded its Batch.CPUBudget.
+var ErrCPUBudget = errors.New("command: CPU budget exceeded")
+
+// cpuMeter measures the CPU time used by the commands of a batch.
+// A nil *cpuMeter measures nothing.
+type cpuMeter struct {
+	budget time.Duration
+	abort  context.CancelCauseFunc
+
+	mu      sync.Mutex
+	used    time.Duration // by the commands that exited
+	running map[int]bool
+}
+
+// start records that the process pid is running.
+func (m *cpuMeter) start(pid int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running == nil {
+		m.running = make(map[int]bool)
+	}
+	m.running[pid] = true
+}
+
+// done records that the process pid exited after using cpu.
+func (m *cpuMeter) done(pid int, cpu time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.running, pid)
+	m.used += cpu
+	m.mu.Unlock()
+	m.check()
+}
+
+// check aborts the batch if the CPU time used exceeds the budget.
+func (m *cpuMeter) check() {
+	m.mu.Lock()
+	total := m.used
+	for pid := range m.running {
+		// The process may have exited but not been waited for yet, in
+		// which case its time is counted by done.
+		if d, err := procCPUTime(pid); err == nil {
+			total += d
+		}
+	}
+	m.mu.Unlock()
+	if total > m.budget {
+		m.abort(ErrCPUBudget)
+	}
+}
+
+// watch checks the budget every interval, 1 second if zero, until the
+// returned function is called.
+func (m *cpuMeter) watch(interval time.Duration) (stop func()) {
+	if interval == 0 {
+		interval = time.Second
+	}
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				m.check()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,41 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// clockTick is the unit of the times in /proc/<pid>/stat. USER_HZ is
+// 100 on all Linux architectures supported by Go.
+const clockTick = 10 * time.Millisecond
+
+// procCPUTime returns the CPU time used by the running process pid and
+// the children it waited for.
+func procCPUTime(pid int) (time.Duration, error) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, err
+	}
+	// The command name, in parentheses, may contain spaces.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	// Fields from the third on: state, ..., utime, stime, cutime, cstime.
+	fields := bytes.Fields(data[i+1:])
+	if len(fields) < 15 {
+		return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+	}
+	var ticks int64
+	for _, f := range fields[11:15] {
+		n, err := strconv.ParseInt(string(f), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("malformed /proc/%d/stat", pid)
+		}
+		ticks += n
+	}
+	return time.Duration(ticks) * clockTick, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package command
+
+import (
+	"errors"
+	"time"
+)
+
+// procCPUTime is only supported on Linux: elsewhere the CPU time of
+// commands is known when they exit.
+func procCPUTime(pid int) (time.Duration, error) {
+	return 0, errors.New("command: CPU time sampling not supported")
+}
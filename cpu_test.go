@@ -0,0 +1,34 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCPUBudget(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("CPU sampling requires /proc")
+	}
+	b := &Batch{
+		Cmds: []*Cmd{
+			{Label: "spin", Path: "sh", Args: []string{"-c", "while :; do :; done"}, Timeout: 10 * time.Second},
+			{Label: "next", Path: "true"},
+		},
+		Parallel:          1,
+		CPUBudget:         100 * time.Millisecond,
+		CPUSampleInterval: 10 * time.Millisecond,
+	}
+	results, err := b.Run(context.Background())
+	if !errors.Is(err, ErrCPUBudget) {
+		t.Fatalf("err = %v, want ErrCPUBudget", err)
+	}
+	if r := results[0]; r.Status != StatusFailed || r.CPUTime < 100*time.Millisecond {
+		t.Errorf("spin: %v after %v of CPU", r.Status, r.CPUTime)
+	}
+	if r := results[1]; r.Status != StatusCanceled || !errors.Is(r.Err, ErrCPUBudget) {
+		t.Errorf("next: %v, %v, want canceled by ErrCPUBudget", r.Status, r.Err)
+	}
+}
@@ -0,0 +1,186 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DebugReport explains how a Batch runs a command, to find out why it
+// behaves differently than in a shell.
+type DebugReport struct {
+	Label string
+
+	// Executable is the resolved path of the executable, and
+	// LookPathErr the error resolving it, if any.
+	Executable  string
+	LookPathErr string `json:",omitempty"`
+	Args        []string
+	Dir         string
+
+	// Env lists the differences between the environment of the command
+	// and the one of the current process.
+	Env []EnvChange
+
+	// Limits applied to the command.
+	Timeout   time.Duration
+	Deadline  time.Time
+	CPUBudget time.Duration
+	Parallel  int
+}
+
+// EnvChange is a difference between two environments.
+type EnvChange struct {
+	Op       string // "added", "removed" or "changed"
+	Key      string
+	Old, New string
+	Redacted bool `json:",omitempty"`
+}
+
+// Debug returns the DebugReport of c, as it would run now.
+func (b *Batch) Debug(c *Cmd) (*DebugReport, error) {
+	ts, err := b.timeouts()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	timeout := ts.apply(c.Timeout)
+	if timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if !c.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.Deadline)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = b.env(ctx, c)
+	return b.debug(ctx, cmd, c, timeout), nil
+}
+
+// writeDebug writes the DebugReport of c, about to be run as cmd, to
+// b.DebugOutput.
+func (b *Batch) writeDebug(ctx context.Context, cmd *exec.Cmd, c *Cmd, timeout time.Duration) {
+	io.WriteString(b.DebugOutput, b.debug(ctx, cmd, c, timeout).String())
+}
+
+// debug returns the DebugReport of c, about to be run as cmd.
+func (b *Batch) debug(ctx context.Context, cmd *exec.Cmd, c *Cmd, timeout time.Duration) *DebugReport {
+	d := &DebugReport{
+		Label:      c.name(),
+		Executable: cmd.Path,
+		Args:       c.Args,
+		Dir:        cmd.Dir,
+		Timeout:    timeout,
+		CPUBudget:  b.CPUBudget,
+		Parallel:   b.Parallel,
+	}
+	if cmd.Err != nil {
+		d.LookPathErr = cmd.Err.Error()
+	}
+	if !filepath.IsAbs(d.Executable) && strings.ContainsRune(d.Executable, filepath.Separator) {
+		d.Executable = filepath.Join(cmd.Dir, d.Executable)
+	}
+	if d.Dir == "" {
+		d.Dir, _ = os.Getwd()
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		d.Deadline = deadline
+	}
+
+	redact := b.Redact
+	if redact == nil {
+		redact = secretKey
+	}
+	parent, env := envMap(os.Environ()), envMap(cmd.Env)
+	for k, v := range env {
+		if old, ok := parent[k]; !ok {
+			d.Env = append(d.Env, EnvChange{Op: "added", Key: k, New: v})
+		} else if old != v {
+			d.Env = append(d.Env, EnvChange{Op: "changed", Key: k, Old: old, New: v})
+		}
+	}
+	for k, v := range parent {
+		if _, ok := env[k]; !ok {
+			d.Env = append(d.Env, EnvChange{Op: "removed", Key: k, Old: v})
+		}
+	}
+	sort.Slice(d.Env, func(i, j int) bool { return d.Env[i].Key < d.Env[j].Key })
+	for i := range d.Env {
+		if e := &d.Env[i]; redact(e.Key) {
+			e.Redacted = true
+			if e.Old != "" {
+				e.Old = "***"
+			}
+			if e.New != "" {
+				e.New = "***"
+			}
+		}
+	}
+	return d
+}
+
+// String formats d for humans.
+func (d *DebugReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "debug %s\n", d.Label)
+	fmt.Fprintf(&sb, "  executable: %s", d.Executable)
+	if d.LookPathErr != "" {
+		fmt.Fprintf(&sb, " (%s)", d.LookPathErr)
+	}
+	fmt.Fprintf(&sb, "\n  args: %q\n  dir: %s\n", d.Args, d.Dir)
+	if d.Timeout != 0 {
+		fmt.Fprintf(&sb, "  timeout: %v\n", d.Timeout)
+	}
+	if !d.Deadline.IsZero() {
+		fmt.Fprintf(&sb, "  deadline: %v\n", d.Deadline.Format(time.RFC3339))
+	}
+	if d.CPUBudget != 0 {
+		fmt.Fprintf(&sb, "  batch CPU budget: %v\n", d.CPUBudget)
+	}
+	if d.Parallel != 0 {
+		fmt.Fprintf(&sb, "  batch parallelism: %d\n", d.Parallel)
+	}
+	for _, e := range d.Env {
+		switch e.Op {
+		case "added":
+			fmt.Fprintf(&sb, "  env +%s=%s\n", e.Key, e.New)
+		case "removed":
+			fmt.Fprintf(&sb, "  env -%s=%s\n", e.Key, e.Old)
+		default:
+			fmt.Fprintf(&sb, "  env ~%s=%s (was %s)\n", e.Key, e.New, e.Old)
+		}
+	}
+	return sb.String()
+}
+
+// envMap returns the variables of env, the last value of duplicate keys
+// winning as for exec.Cmd.
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			m[kv[:i]] = kv[i+1:]
+		}
+	}
+	return m
+}
+
+func secretKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, s := range []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "AUTH"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
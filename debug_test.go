@@ -0,0 +1,57 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugReport(t *testing.T) {
+	t.Setenv("DEBUG_KEEP", "1")
+	t.Setenv("DEBUG_CHANGE", "old")
+	t.Setenv("DEBUG_DROP", "1")
+	t.Setenv("API_TOKEN", "hunter2")
+	env := []string{"DEBUG_KEEP=1", "DEBUG_CHANGE=new", "API_TOKEN=s3cret", "PATH=/usr/bin:/bin"}
+	c := &Cmd{Label: "sh", Path: "sh", Args: []string{"-c", "true"}, Env: env, Timeout: time.Minute}
+	b := &Batch{RunID: "run1", TimeoutScale: 2}
+	d, err := b.Debug(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.LookPathErr != "" || !strings.HasSuffix(d.Executable, "/sh") {
+		t.Errorf("executable %q (%s)", d.Executable, d.LookPathErr)
+	}
+	if d.Timeout != 2*time.Minute || d.Deadline.IsZero() {
+		t.Errorf("timeout %v, deadline %v", d.Timeout, d.Deadline)
+	}
+	s := d.String()
+	for _, want := range []string{
+		"  env ~DEBUG_CHANGE=new (was old)\n",
+		"  env -DEBUG_DROP=1\n",
+		"  env +COMMAND_RUN_ID=run1\n",
+		"  env ~API_TOKEN=*** (was ***)\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("missing %q in\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "DEBUG_KEEP") || strings.Contains(s, "s3cret") {
+		t.Errorf("unexpected content in\n%s", s)
+	}
+}
+
+func TestDebugOutputConcurrent(t *testing.T) {
+	var out bytes.Buffer
+	b := &Batch{DebugOutput: &out}
+	for _, label := range []string{"a", "b", "c", "d"} {
+		b.Cmds = append(b.Cmds, &Cmd{Label: label, Path: "true"})
+	}
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.String(), "debug "); n != 4 {
+		t.Errorf("%d reports, want 4:\n%s", n, out.String())
+	}
+}
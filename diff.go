@@ -0,0 +1,160 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+)
+
+// edit is an operation of a line diff: ' ' keeps, '-' deletes and '+'
+// inserts line.
+type edit struct {
+	op   byte
+	line string
+}
+
+// maxEdits bounds the edit distance searched by diffLines, and so its
+// memory use, quadratic in the distance.
+const maxEdits = 1000
+
+// diffLines returns the shortest edit script turning a into b, using
+// the Myers algorithm. It returns false if more than maxEdits edits are
+// needed.
+func diffLines(a, b []string) ([]edit, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil, true
+	}
+	v := make([]int, 2*max+2)
+	// trace[d] holds v[max-d:max+d+1] before step d.
+	var trace [][]int
+	found := false
+search:
+	for d := 0; d <= max && d <= maxEdits; d++ {
+		trace = append(trace, append([]int(nil), v[max-d:max+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				found = true
+				break search
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var pk int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := 0
+		if d > 0 {
+			px = v[d+pk]
+		}
+		py := px - pk
+		for x > px && y > py {
+			edits = append(edits, edit{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == px {
+				edits = append(edits, edit{'+', b[y-1]})
+				y--
+			} else {
+				edits = append(edits, edit{'-', a[x-1]})
+				x--
+			}
+		}
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits, true
+}
+
+// unifiedDiff returns the unified diff, with three lines of context,
+// turning a into b, or "" if they are equal. If a and b differ too much
+// to be diffed, it only tells their number of lines.
+func unifiedDiff(aName, bName string, a, b []string) string {
+	const context = 3
+	edits, ok := diffLines(a, b)
+	if !ok {
+		return fmt.Sprintf("--- %s\n+++ %s\noutput changed: %d lines, %d before\n", aName, bName, len(b), len(a))
+	}
+
+	// apos[i] and bpos[i] are the lines of a and b before edits[i].
+	apos := make([]int, len(edits)+1)
+	bpos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		apos[i+1], bpos[i+1] = apos[i], bpos[i]
+		if e.op != '+' {
+			apos[i+1]++
+		}
+		if e.op != '-' {
+			bpos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			i++
+			continue
+		}
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		last := i
+		for j := i; j < len(edits) && j-last <= 2*context; j++ {
+			if edits[j].op != ' ' {
+				last = j
+			}
+		}
+		end := last + context + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(apos[start], apos[end]-apos[start]),
+			hunkRange(bpos[start], bpos[end]-bpos[start]))
+		for _, e := range edits[start:end] {
+			fmt.Fprintf(&sb, "%c%s\n", e.op, e.line)
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
@@ -0,0 +1,117 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := strings.Split("a b c d e f g h i j", " ")
+	b := strings.Split("a b c x e f g h i j k", " ")
+	want := `--- a
++++ b
+@@ -1,7 +1,7 @@
+ a
+ b
+ c
+-d
++x
+ e
+ f
+ g
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+`
+	if got := unifiedDiff("a", "b", a, b); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if got := unifiedDiff("a", "b", a, a); got != "" {
+		t.Errorf("diff of equal lines: %q", got)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		l := make([]string, r.Intn(30))
+		for i := range l {
+			l[i] = string(rune('a' + r.Intn(4)))
+		}
+		return l
+	}
+	for i := 0; i < 200; i++ {
+		a, b := lines(), lines()
+		edits, ok := diffLines(a, b)
+		if !ok {
+			t.Fatalf("no diff of %q and %q", a, b)
+		}
+		var gotA, gotB []string
+		for _, e := range edits {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("edits %v do not turn %q into %q", edits, a, b)
+		}
+	}
+}
+
+func TestUnifiedDiffLarge(t *testing.T) {
+	a := make([]string, 8000)
+	b := make([]string, 8000)
+	for i := range a {
+		a[i], b[i] = fmt.Sprint("a", i), fmt.Sprint("b", i)
+	}
+	want := "--- a\n+++ b\noutput changed: 8000 lines, 8000 before\n"
+	if got := unifiedDiff("a", "b", a, b); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCompareOutput(t *testing.T) {
+	h := &History{Dir: t.TempDir()}
+	stamp := regexp.MustCompile(`[0-9]+`)
+	run := func(script string) *Result {
+		b := &Batch{
+			Cmds:          []*Cmd{{Label: "tool", Path: "sh", Args: []string{"-c", script}}},
+			Capture:       true,
+			History:       h,
+			CompareOutput: true,
+			Normalize: func(l string) string {
+				return stamp.ReplaceAllString(l, "N")
+			},
+		}
+		results, _ := b.Run(context.Background())
+		return results[0]
+	}
+	if r := run("echo one; echo at $$"); r.Change != nil {
+		t.Fatalf("first run: change %+v", r.Change)
+	}
+	if r := run("echo one; echo at $$"); r.Change != nil {
+		t.Fatalf("same output: change %+v", r.Change)
+	}
+	r := run("echo two; echo at $$; echo warn >&2")
+	if r.Change == nil {
+		t.Fatal("no change reported")
+	}
+	if want := []string{"warn"}; len(r.Change.NewStderr) != 1 || r.Change.NewStderr[0] != want[0] {
+		t.Errorf("NewStderr = %q, want %q", r.Change.NewStderr, want)
+	}
+	var buf bytes.Buffer
+	WriteReport(&buf, []*Result{r})
+	if !strings.Contains(buf.String(), "    -one\n    +two\n") {
+		t.Errorf("report missing diff:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,55 @@
+package command
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variables set by Batch for every command, so that it can
+// correlate its logs and shut down cleanly before being killed.
+const (
+	// EnvRunID holds the RunID of the batch.
+	EnvRunID = "COMMAND_RUN_ID"
+	// EnvLabel holds the label of the command.
+	EnvLabel = "COMMAND_LABEL"
+	// EnvDeadline holds the time at which the command will be killed,
+	// in RFC 3339 format. It is only set if the command has a deadline.
+	EnvDeadline = "COMMAND_DEADLINE"
+	// EnvDeadlineSeconds holds the whole number of seconds left before
+	// the deadline, when the command is started.
+	EnvDeadlineSeconds = "COMMAND_DEADLINE_SECONDS"
+)
+
+// env returns the environment of c when run under ctx, which carries
+// the effective deadline of the command.
+func (b *Batch) env(ctx context.Context, c *Cmd) []string {
+	env := c.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append(env[:len(env):len(env)],
+		EnvRunID+"="+b.RunID,
+		EnvLabel+"="+c.name(),
+	)
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline) / time.Second
+		if left < 0 {
+			left = 0
+		}
+		env = append(env,
+			EnvDeadline+"="+deadline.Format(time.RFC3339Nano),
+			EnvDeadlineSeconds+"="+strconv.FormatInt(int64(left), 10),
+		)
+	}
+	return env
+}
+
+func newRunID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlineEnv(t *testing.T) {
+	b := &Batch{
+		Cmds: []*Cmd{
+			{Label: "env", Path: "sh", Args: []string{"-c", "echo $COMMAND_RUN_ID $COMMAND_LABEL $COMMAND_DEADLINE_SECONDS"}, Timeout: time.Minute},
+		},
+		Capture: true,
+		RunID:   "run1",
+	}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.TrimSpace(string(results[0].Stdout))
+	if got != "run1 env 59" && got != "run1 env 60" {
+		t.Errorf("got %q, want %q", got, "run1 env 59")
+	}
+}
+
+func TestRunIDPerRun(t *testing.T) {
+	b := &Batch{Cmds: []*Cmd{{Path: "true"}}}
+	r1, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1[0].RunID == "" || r1[0].RunID == r2[0].RunID {
+		t.Errorf("run IDs %q and %q, want distinct", r1[0].RunID, r2[0].RunID)
+	}
+	if b.RunID != "" {
+		t.Errorf("RunID %q set in batch", b.RunID)
+	}
+}
@@ -1,3 +1,5 @@
 module eleztian/command
 
+go 1.20
+
 require golang.org/x/sync v0.0.0-20190423024810-112230192c58
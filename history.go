@@ -0,0 +1,256 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// History stores the results of past runs of commands in a directory,
+// in one JSON file per command label.
+type History struct {
+	// Dir is the directory holding the history files.
+	// It is created if needed.
+	Dir string
+
+	// Keep is the number of runs kept per command, 10 if zero.
+	Keep int
+
+	mu sync.Mutex
+}
+
+// Record is a past run of a command, as stored in a History.
+type Record struct {
+	RunID    string `json:",omitempty"`
+	Start    time.Time
+	Duration time.Duration
+	Status   Status
+	ExitCode int
+	Err      string `json:",omitempty"`
+
+	// Captured reports whether the output of the command was captured,
+	// in Stdout and Stderr.
+	Captured bool   `json:",omitempty"`
+	Stdout   string `json:",omitempty"`
+	Stderr   string `json:",omitempty"`
+}
+
+func newRecord(r *Result) Record {
+	rec := Record{
+		RunID:    r.RunID,
+		Start:    r.Start,
+		Duration: r.Duration(),
+		Status:   r.Status,
+		ExitCode: r.ExitCode,
+		Captured: r.Stdout != nil || r.Stderr != nil,
+		Stdout:   string(r.Stdout),
+		Stderr:   string(r.Stderr),
+	}
+	if r.Err != nil {
+		rec.Err = r.Err.Error()
+	}
+	return rec
+}
+
+// result returns the Result of c recorded in rec.
+func (rec *Record) result(c *Cmd) *Result {
+	r := &Result{
+		Cmd:      c,
+		RunID:    rec.RunID,
+		Start:    rec.Start,
+		End:      rec.Start.Add(rec.Duration),
+		Status:   rec.Status,
+		ExitCode: rec.ExitCode,
+	}
+	if rec.Err != "" {
+		r.Err = errors.New(rec.Err)
+	}
+	if rec.Captured {
+		r.Stdout, r.Stderr = []byte(rec.Stdout), []byte(rec.Stderr)
+	}
+	return r
+}
+
+// Record appends the result r to the history of its command.
+func (h *History) Record(r *Result) error {
+	rec := newRecord(r)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	recs, err := h.records(r.Cmd.name())
+	if err != nil {
+		return err
+	}
+	recs = append(recs, rec)
+	keep := h.Keep
+	if keep == 0 {
+		keep = 10
+	}
+	if len(recs) > keep {
+		recs = recs[len(recs)-keep:]
+	}
+	data, err := json.Marshal(recs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(h.Dir, 0755); err != nil {
+		return err
+	}
+	tmp := h.file(r.Cmd.name()) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.file(r.Cmd.name()))
+}
+
+// Records returns the recorded runs of the command labelled label,
+// oldest first.
+func (h *History) Records(label string) ([]Record, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.records(label)
+}
+
+// Duration returns the average duration of the successful recorded
+// runs of the command labelled label. It returns false if there are
+// none.
+func (h *History) Duration(label string) (time.Duration, bool) {
+	recs, err := h.Records(label)
+	if err != nil {
+		return 0, false
+	}
+	var sum time.Duration
+	var n int
+	for _, rec := range recs {
+		if rec.Status == StatusOK {
+			sum += rec.Duration
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / time.Duration(n), true
+}
+
+// Change describes how the output of a command changed since its
+// previous successful run.
+type Change struct {
+	// Prev is the start time of the previous successful run.
+	Prev time.Time
+
+	PrevExitCode int
+	ExitCode     int
+
+	// Diff is the unified diff of the normalized standard output,
+	// empty if it did not change.
+	Diff string
+
+	// NewStderr lists the normalized lines of standard error that the
+	// previous run did not print.
+	NewStderr []string
+}
+
+// Compare compares the captured output and exit code of r with those of
+// the last successful run of its command recorded in h, which must not
+// include r yet. Each line of output is passed through normalize, if not
+// nil, and stripped of trailing white space before comparison, so that
+// varying parts such as timestamps can be masked.
+//
+// Compare returns nil if nothing changed, or if there is no previous
+// successful run with captured output to compare with.
+func (h *History) Compare(r *Result, normalize func(string) string) (*Change, error) {
+	recs, err := h.Records(r.Cmd.name())
+	if err != nil {
+		return nil, err
+	}
+	var prev *Record
+	for i := len(recs) - 1; i >= 0 && prev == nil; i-- {
+		if recs[i].Status == StatusOK && recs[i].Captured {
+			prev = &recs[i]
+		}
+	}
+	if prev == nil {
+		return nil, nil
+	}
+
+	ch := &Change{Prev: prev.Start, PrevExitCode: prev.ExitCode, ExitCode: r.ExitCode}
+	ch.Diff = unifiedDiff("previous", "current",
+		normalizeLines(prev.Stdout, normalize),
+		normalizeLines(string(r.Stdout), normalize))
+	seen := make(map[string]bool)
+	for _, l := range normalizeLines(prev.Stderr, normalize) {
+		seen[l] = true
+	}
+	for _, l := range normalizeLines(string(r.Stderr), normalize) {
+		if !seen[l] {
+			seen[l] = true
+			ch.NewStderr = append(ch.NewStderr, l)
+		}
+	}
+	if ch.ExitCode == ch.PrevExitCode && ch.Diff == "" && len(ch.NewStderr) == 0 {
+		return nil, nil
+	}
+	return ch, nil
+}
+
+func normalizeLines(s string, normalize func(string) string) []string {
+	s = strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if normalize != nil {
+			l = normalize(l)
+		}
+		lines[i] = strings.TrimRight(l, " \t\r")
+	}
+	return lines
+}
+
+// Labels returns the labels of the commands in h, sorted.
+func (h *History) Labels() ([]string, error) {
+	entries, err := os.ReadDir(h.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var labels []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if label, err := url.PathUnescape(strings.TrimSuffix(name, ".json")); err == nil {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+func (h *History) records(label string) ([]Record, error) {
+	data, err := os.ReadFile(h.file(label))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var recs []Record
+	err = json.Unmarshal(data, &recs)
+	return recs, err
+}
+
+func (h *History) file(label string) string {
+	return filepath.Join(h.Dir, url.PathEscape(label)+".json")
+}
@@ -0,0 +1,126 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// KeyStore remembers, in a directory, the successful results of the
+// commands with an IdempotencyKey, so that a job is run once per key.
+// Commands with the same key running at the same time through the same
+// KeyStore wait for the first one to finish.
+//
+// A KeyStore must not be copied after first use.
+type KeyStore struct {
+	// Dir is the directory holding a JSON file per key.
+	// It is created if needed.
+	Dir string
+
+	// Window is how long a result is remembered. Zero means forever.
+	Window time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+}
+
+// Get returns the result recorded for key, or nil if there is none
+// within the window.
+func (s *KeyStore) Get(key string) (*Record, error) {
+	data, err := os.ReadFile(s.file(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec Record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	if s.Window != 0 && time.Since(rec.Start.Add(rec.Duration)) > s.Window {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+// Put records the result r for key.
+func (s *KeyStore) Put(key string, r *Result) error {
+	data, err := json.Marshal(newRecord(r))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	tmp := s.file(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file(key))
+}
+
+// acquire returns the recorded result of c, replayed, or a result
+// explaining why it cannot tell. It returns nil if c must run, in
+// which case release must be called with its result. If another
+// command holds the key, acquire calls wait, if not nil, once before
+// waiting for it.
+func (s *KeyStore) acquire(ctx context.Context, c *Cmd, wait func()) *Result {
+	key := c.IdempotencyKey
+	for {
+		s.mu.Lock()
+		done, busy := s.inflight[key]
+		if !busy {
+			if s.inflight == nil {
+				s.inflight = make(map[string]chan struct{})
+			}
+			s.inflight[key] = make(chan struct{})
+		}
+		s.mu.Unlock()
+		if !busy {
+			break
+		}
+		if wait != nil {
+			wait()
+			wait = nil
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return &Result{Cmd: c, Status: StatusCanceled, ExitCode: -1, Err: ctx.Err()}
+		}
+	}
+
+	rec, err := s.Get(key)
+	if err == nil && rec == nil {
+		return nil
+	}
+	s.release(key, nil)
+	if err != nil {
+		return &Result{Cmd: c, Status: StatusFailed, ExitCode: -1, Err: err}
+	}
+	r := rec.result(c)
+	r.Replayed = true
+	return r
+}
+
+// release records r for key if it succeeded and lets the commands
+// waiting for key go. Recording is best effort.
+func (s *KeyStore) release(key string, r *Result) {
+	if r != nil && r.Status == StatusOK {
+		s.Put(key, r)
+	}
+	s.mu.Lock()
+	close(s.inflight[key])
+	delete(s.inflight, key)
+	s.mu.Unlock()
+}
+
+func (s *KeyStore) file(key string) string {
+	return filepath.Join(s.Dir, url.PathEscape(key)+".json")
+}
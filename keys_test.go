@@ -0,0 +1,75 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	dir := t.TempDir()
+	count := filepath.Join(dir, "count")
+	job := func() *Cmd {
+		return &Cmd{
+			Path:           "sh",
+			Args:           []string{"-c", "echo x >> " + count + "; echo done"},
+			IdempotencyKey: "job-1",
+		}
+	}
+	keys := &KeyStore{Dir: filepath.Join(dir, "keys")}
+	b := &Batch{Cmds: []*Cmd{job(), job(), job()}, Keys: keys, Capture: true}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := 0
+	for _, r := range results {
+		if string(r.Stdout) != "done\n" {
+			t.Errorf("stdout %q, want %q", r.Stdout, "done\n")
+		}
+		if r.Replayed {
+			replayed++
+		}
+	}
+	if replayed != 2 {
+		t.Errorf("%d results replayed, want 2", replayed)
+	}
+
+	keys.Window = time.Nanosecond
+	if _, err := (&Batch{Cmds: []*Cmd{job()}, Keys: keys}).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(count)
+	if n := strings.Count(string(data), "x"); n != 2 {
+		t.Errorf("job ran %d times, want 2", n)
+	}
+}
+
+func TestIdempotencyKeyPool(t *testing.T) {
+	keys := &KeyStore{Dir: t.TempDir()}
+	p := &Pool{Slots: 1}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprint("job", i)
+		b := &Batch{
+			Cmds: []*Cmd{
+				{Path: "sleep", Args: []string{"0.01"}, IdempotencyKey: key},
+				{Path: "sleep", Args: []string{"0.01"}, IdempotencyKey: key},
+			},
+			Keys: keys,
+			Pool: p,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		results, err := b.Run(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+		if results[0].Replayed == results[1].Replayed {
+			t.Errorf("run %d: replayed %v and %v, want one replay", i, results[0].Replayed, results[1].Replayed)
+		}
+	}
+}
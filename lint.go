@@ -0,0 +1,252 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// LintIssue is a problem found in the commands of a Batch by Lint.
+type LintIssue struct {
+	Label string `json:",omitempty"`
+
+	// Check names the check that found the issue: "duplicate-label",
+	// "missing-executable", "stream", "stream-cycle", "gate",
+	// "timeout" or "shell".
+	Check string
+
+	// Error is true for issues that make the batch fail, false for
+	// those that may only be suspicious.
+	Error bool
+
+	Message string
+}
+
+func (i LintIssue) String() string {
+	level := "warning"
+	if i.Error {
+		level = "error"
+	}
+	if i.Label == "" {
+		return fmt.Sprintf("%s: %s: %s", level, i.Check, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", i.Label, level, i.Check, i.Message)
+}
+
+// Lint checks the commands of b without running them, in this order:
+// for duplicate labels; for executables not found, including the first
+// command of the shell scripts run with -c; for streams used with a
+// Pool, naming unknown commands or forming cycles, which never end; for
+// gated commands without an Approver, which are always denied; for
+// timeouts, after scaling, shorter than the average duration recorded
+// in b.History; and for shell scripts run with sh -c or bash -c using
+// eval or piping into a shell.
+//
+// In strict mode, a caller should treat every issue as fatal, not only
+// those with Error set.
+func (b *Batch) Lint() []LintIssue {
+	var issues []LintIssue
+	add := func(label, check string, isErr bool, format string, args ...any) {
+		issues = append(issues, LintIssue{Label: label, Check: check, Error: isErr, Message: fmt.Sprintf(format, args...)})
+	}
+
+	seen := make(map[string]bool)
+	for _, c := range b.Cmds {
+		if seen[c.name()] {
+			add(c.name(), "duplicate-label", true, "label used by several commands")
+		}
+		seen[c.name()] = true
+	}
+
+	for _, c := range b.Cmds {
+		if err := lookPath(c); err != nil {
+			add(c.name(), "missing-executable", true, "%v", err)
+		} else if script, ok := shellScript(c); ok {
+			if name := scriptCommand(script); name != "" {
+				if err := lookPath(&Cmd{Path: name, Dir: c.Dir}); err != nil {
+					add(c.name(), "missing-executable", true, "script: %v", err)
+				}
+			}
+		}
+	}
+
+	if b.Pool != nil && len(b.Streams) > 0 {
+		add("", "stream", true, "%v", errStreamPool)
+	}
+	next := make(map[string][]string)
+	for _, s := range b.Streams {
+		ok := true
+		for _, label := range []string{s.From, s.To} {
+			if !seen[label] {
+				add("", "stream", true, "no command %q", label)
+				ok = false
+			}
+		}
+		if ok {
+			next[s.From] = append(next[s.From], s.To)
+		}
+	}
+	for _, cycle := range streamCycles(b.Cmds, next) {
+		add(cycle[0], "stream-cycle", true, "streams form a cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	if b.Approver == nil {
+		for _, c := range b.Cmds {
+			if c.Gate {
+				add(c.name(), "gate", true, "gated command without an approver is always denied")
+			}
+		}
+	}
+
+	if ts, err := b.timeouts(); err != nil {
+		add("", "timeout", true, "%v", err)
+	} else if b.History != nil {
+		for _, c := range b.Cmds {
+			if c.Timeout == 0 {
+				continue
+			}
+			if d, ok := b.History.Duration(c.name()); ok && ts.apply(c.Timeout) < d {
+				add(c.name(), "timeout", false, "timeout %v shorter than average duration %v", ts.apply(c.Timeout), d.Round(1e6))
+			}
+		}
+	}
+
+	for _, c := range b.Cmds {
+		if script, ok := shellScript(c); ok {
+			for _, u := range unsafeShell {
+				if u.re.MatchString(script) {
+					add(c.name(), "shell", false, "%s", u.msg)
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// LintProcfile checks the commands of the Procfile read from r, as
+// parsed by ParseProcfile, with Batch.Lint. Duplicate labels are
+// reported as issues rather than errors.
+func LintProcfile(r io.Reader) ([]LintIssue, error) {
+	cmds, err := parseProcfile(r, false)
+	if err != nil {
+		return nil, err
+	}
+	return (&Batch{Cmds: cmds}).Lint(), nil
+}
+
+// lookPath reports whether the executable of c can be found.
+func lookPath(c *Cmd) error {
+	if !strings.Contains(c.Path, string(filepath.Separator)) {
+		_, err := exec.LookPath(c.Path)
+		return err
+	}
+	path := c.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(c.Dir, path)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() || fi.Mode()&0111 == 0 {
+		return fmt.Errorf("%s: not an executable", path)
+	}
+	return nil
+}
+
+// streamCycles returns the cycles of the graph of streams next, each
+// as the labels along it, the first repeated at the end.
+func streamCycles(cmds []*Cmd, next map[string][]string) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var (
+		path   []string
+		cycles [][]string
+		visit  func(label string)
+	)
+	visit = func(label string) {
+		state[label] = visiting
+		path = append(path, label)
+		for _, to := range next[label] {
+			switch state[to] {
+			case unvisited:
+				visit(to)
+			case visiting:
+				for i, l := range path {
+					if l == to {
+						cycles = append(cycles, append(append([]string(nil), path[i:]...), to))
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[label] = done
+	}
+	for _, c := range cmds {
+		if state[c.name()] == unvisited {
+			visit(c.name())
+		}
+	}
+	return cycles
+}
+
+// shellScript returns the script of c if it runs one with -c.
+func shellScript(c *Cmd) (string, bool) {
+	switch filepath.Base(c.Path) {
+	case "sh", "bash", "dash", "zsh", "ksh":
+	default:
+		return "", false
+	}
+	for i, a := range c.Args {
+		if a == "-c" && i+1 < len(c.Args) {
+			return c.Args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// scriptCommand returns the first command run by script, after any
+// variable assignments, or "" if it is a builtin or not a plain word.
+func scriptCommand(script string) string {
+	for _, w := range strings.Fields(script) {
+		switch {
+		case assignment.MatchString(w), w == "exec", w == "command":
+			continue
+		case strings.ContainsAny(w, "$`'\"\\(){};&|<>*?[") || shellBuiltin(w):
+			return ""
+		}
+		return w
+	}
+	return ""
+}
+
+var assignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// shellBuiltin reports whether w is a shell builtin or keyword.
+func shellBuiltin(w string) bool {
+	switch w {
+	case ".", ":", "!", "alias", "break", "case", "cd", "continue", "echo", "eval", "exit",
+		"export", "false", "for", "if", "local", "printf", "pwd", "read", "readonly", "return",
+		"set", "shift", "source", "test", "times", "trap", "true", "type", "ulimit", "umask",
+		"unalias", "unset", "until", "wait", "while":
+		return true
+	}
+	return false
+}
+
+var unsafeShell = []struct {
+	re  *regexp.Regexp
+	msg string
+}{
+	{regexp.MustCompile(`(^|[;&|(\s])eval\s`), "script uses eval"},
+	{regexp.MustCompile(`\|\s*(sudo\s+)?(sh|bash|dash|zsh|ksh)\b`), "script pipes into a shell"},
+	{regexp.MustCompile(`\brm\s+-[a-zA-Z]*[rR][a-zA-Z]*\s+(\S*\s+)*"?\$\{?\w+\}?"?/?(\s|$)`), "script removes recursively a path from a variable"},
+}
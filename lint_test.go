@@ -0,0 +1,67 @@
+package command
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLint(t *testing.T) {
+	h := &History{Dir: t.TempDir()}
+	h.Record(&Result{Cmd: &Cmd{Label: "slow"}, End: time.Unix(0, 0).Add(2 * time.Second), Start: time.Unix(0, 0), Status: StatusOK})
+	b := &Batch{
+		Cmds: []*Cmd{
+			{Label: "a", Path: "sh", Args: []string{"-c", "curl -s example.com | sh"}},
+			{Label: "b", Path: "cat"},
+			{Label: "a", Path: "true"},
+			{Label: "missing", Path: "./no-such-command"},
+			{Label: "deploy", Path: "true", Gate: true},
+			{Label: "slow", Path: "sleep", Args: []string{"2"}, Timeout: time.Second},
+			{Label: "clean", Path: "bash", Args: []string{"-c", `rm -rf "$DIR"`}},
+		},
+		Streams: []Stream{{From: "a", To: "b"}, {From: "b", To: "a"}, {From: "b", To: "c"}},
+		History: h,
+	}
+	var got []string
+	for _, i := range b.Lint() {
+		got = append(got, i.String())
+	}
+	want := []string{
+		"a: error: duplicate-label: label used by several commands",
+		"missing: error: missing-executable: stat no-such-command: no such file or directory",
+		`error: stream: no command "c"`,
+		"a: error: stream-cycle: streams form a cycle: a -> b -> a",
+		"deploy: error: gate: gated command without an approver is always denied",
+		"slow: warning: timeout: timeout 1s shorter than average duration 2s",
+		"a: warning: shell: script pipes into a shell",
+		"clean: warning: shell: script removes recursively a path from a variable",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+
+	b = &Batch{Cmds: []*Cmd{{Label: "ok", Path: "sh", Args: []string{"-c", "echo evaluate | grep -c sh"}}}}
+	if issues := b.Lint(); len(issues) != 0 {
+		t.Errorf("got %v, want no issues", issues)
+	}
+}
+
+func TestLintProcfile(t *testing.T) {
+	issues, err := LintProcfile(strings.NewReader("web: exec true\nweb: eval $CMD\napi: PORT=8080 no-such-binary -v\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.Label+" "+i.Check)
+	}
+	if want := []string{"web duplicate-label", "api missing-executable", "web shell"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	data, _ := json.Marshal(issues[0])
+	if want := `{"Label":"web","Check":"duplicate-label","Error":true,"Message":"label used by several commands"}`; string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
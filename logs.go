@@ -0,0 +1,131 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// LogQuery selects lines of the output recorded in a History.
+type LogQuery struct {
+	// Labels restricts the search to the commands with these labels.
+	// All commands are searched if empty.
+	Labels []string
+
+	// RunID restricts the search to a run of a batch.
+	RunID string
+
+	// Stream restricts the search to "stdout" or "stderr".
+	Stream string
+
+	// Since and Until restrict the search to the runs started in
+	// [Since, Until), each bound applying only if not zero.
+	Since time.Time
+	Until time.Time
+
+	// Pattern selects the matching lines. All lines match if nil.
+	Pattern *regexp.Regexp
+
+	// Context is the number of lines printed around each match.
+	Context int
+}
+
+// LogLine is a line of output found by History.Search.
+type LogLine struct {
+	Label  string
+	RunID  string
+	Start  time.Time // of the run
+	Stream string
+	Line   int // 1-based
+	Text   string
+
+	// Match is false for the context lines.
+	Match bool
+}
+
+// Search returns the lines of the captured output of the recorded runs
+// matching q, in the order of labels, runs and streams, along with
+// their context lines.
+func (h *History) Search(q LogQuery) ([]LogLine, error) {
+	labels := q.Labels
+	if len(labels) == 0 {
+		var err error
+		if labels, err = h.Labels(); err != nil {
+			return nil, err
+		}
+	}
+	var res []LogLine
+	for _, label := range labels {
+		recs, err := h.Records(label)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range recs {
+			if !rec.Captured || q.RunID != "" && rec.RunID != q.RunID ||
+				!q.Since.IsZero() && rec.Start.Before(q.Since) ||
+				!q.Until.IsZero() && !rec.Start.Before(q.Until) {
+				continue
+			}
+			for _, stream := range []struct{ name, out string }{{"stdout", rec.Stdout}, {"stderr", rec.Stderr}} {
+				if q.Stream != "" && q.Stream != stream.name {
+					continue
+				}
+				tmpl := LogLine{Label: label, RunID: rec.RunID, Start: rec.Start, Stream: stream.name}
+				res = append(res, searchLines(tmpl, stream.out, q.Pattern, q.Context)...)
+			}
+		}
+	}
+	return res, nil
+}
+
+// searchLines returns the lines of out matching pattern with n lines of
+// context, filling in the other fields from tmpl.
+func searchLines(tmpl LogLine, out string, pattern *regexp.Regexp, n int) []LogLine {
+	lines := normalizeLines(out, nil)
+	keep := make([]bool, len(lines))
+	match := make([]bool, len(lines))
+	for i, l := range lines {
+		if pattern != nil && !pattern.MatchString(l) {
+			continue
+		}
+		match[i] = true
+		for j := i - n; j <= i+n; j++ {
+			if j >= 0 && j < len(lines) {
+				keep[j] = true
+			}
+		}
+	}
+	var res []LogLine
+	for i, l := range lines {
+		if keep[i] {
+			ll := tmpl
+			ll.Line, ll.Text, ll.Match = i+1, l, match[i]
+			res = append(res, ll)
+		}
+	}
+	return res
+}
+
+// WriteLogs writes lines to w in the style of grep: matches as
+// "label[stream]:line: text", context lines with "-" instead of ":",
+// and "--" between non-contiguous groups of lines.
+func WriteLogs(w io.Writer, lines []LogLine) error {
+	var buf bytes.Buffer
+	for i, l := range lines {
+		if i > 0 {
+			p := lines[i-1]
+			if p.Label != l.Label || !p.Start.Equal(l.Start) || p.Stream != l.Stream || p.Line+1 != l.Line {
+				buf.WriteString("--\n")
+			}
+		}
+		sep := '-'
+		if l.Match {
+			sep = ':'
+		}
+		fmt.Fprintf(&buf, "%s[%s]%c%d%c %s\n", l.Label, l.Stream, sep, l.Line, sep, l.Text)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSearchLogs(t *testing.T) {
+	h := &History{Dir: t.TempDir()}
+	b := &Batch{
+		Cmds: []*Cmd{
+			{Label: "build", Path: "sh", Args: []string{"-c", "echo a; echo b; echo error: c; echo d; echo e; echo f; echo error: g"}},
+			{Label: "test", Path: "sh", Args: []string{"-c", "echo error: t >&2"}},
+		},
+		Capture: true,
+		History: h,
+	}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, err := h.Search(LogQuery{
+		RunID:   results[0].RunID,
+		Stream:  "stdout",
+		Pattern: regexp.MustCompile(`^error:`),
+		Context: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	WriteLogs(&sb, lines)
+	want := `build[stdout]-2- b
+build[stdout]:3: error: c
+build[stdout]-4- d
+--
+build[stdout]-6- f
+build[stdout]:7: error: g
+`
+	if sb.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", sb.String(), want)
+	}
+
+	lines, _ = h.Search(LogQuery{Labels: []string{"test"}, RunID: "other"})
+	if len(lines) != 0 {
+		t.Errorf("got %d lines of another run", len(lines))
+	}
+}
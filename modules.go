@@ -0,0 +1,93 @@
+package command
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FindModules returns the directories under root, root included, that
+// contain a file named marker, "go.mod" if marker is empty. Hidden
+// directories and directories named vendor or testdata are not searched.
+func FindModules(root, marker string) ([]string, error) {
+	if marker == "" {
+		marker = "go.mod"
+	}
+	var dirs []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if p != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == marker {
+			dirs = append(dirs, filepath.Dir(p))
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// ModuleCmds returns a copy of tmpl for each of dirs, with Dir set to
+// the directory and Label to its path relative to root.
+//
+// The copies share the Stdout and Stderr of tmpl, which are wrapped to
+// serialize their writes unless they are files. They also share its
+// Stdin, which should be nil unless a single copy is run.
+func ModuleCmds(root string, dirs []string, tmpl *Cmd) []*Cmd {
+	stdout, stderr := shareWriter(tmpl.Stdout), shareWriter(tmpl.Stderr)
+	if tmpl.Stdout != nil && tmpl.Stdout == tmpl.Stderr {
+		stderr = stdout
+	}
+	cmds := make([]*Cmd, 0, len(dirs))
+	for _, dir := range dirs {
+		c := *tmpl
+		c.Args = append([]string(nil), tmpl.Args...)
+		if tmpl.Env != nil {
+			c.Env = append([]string{}, tmpl.Env...)
+		}
+		c.ExtraFiles = append([]*os.File(nil), tmpl.ExtraFiles...)
+		c.Inputs = append([]string(nil), tmpl.Inputs...)
+		c.Stdout, c.Stderr = stdout, stderr
+		c.Dir = dir
+		c.Label = dir
+		if rel, err := filepath.Rel(root, dir); err == nil {
+			c.Label = filepath.ToSlash(rel)
+		}
+		cmds = append(cmds, &c)
+	}
+	return cmds
+}
+
+// shareWriter returns w made safe for concurrent use.
+func shareWriter(w io.Writer) io.Writer {
+	switch w.(type) {
+	case nil, *os.File, *syncWriter:
+		return w
+	}
+	return &syncWriter{w: w}
+}
+
+// RunModules runs tmpl concurrently in every module found under root
+// by FindModules, capturing the output of each, and returns a result
+// per module.
+//
+//	results, err := RunModules(ctx, ".", "", NewCmd("go", 0, "test", "./..."))
+//	for _, r := range results {
+//		fmt.Println(r)
+//	}
+func RunModules(ctx context.Context, root, marker string, tmpl *Cmd) ([]*Result, error) {
+	dirs, err := FindModules(root, marker)
+	if err != nil {
+		return nil, err
+	}
+	b := &Batch{Cmds: ModuleCmds(root, dirs, tmpl), Capture: true}
+	return b.Run(ctx)
+}
@@ -0,0 +1,52 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunModules(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b/c", ".hidden", "vendor/x"} {
+		os.MkdirAll(filepath.Join(root, dir), 0755)
+		if err := os.WriteFile(filepath.Join(root, dir, "go.mod"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := RunModules(context.Background(), root, "", NewCmd("ls", 0, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for i, label := range []string{"a", "b/c"} {
+		r := results[i]
+		if r.Cmd.Label != label {
+			t.Errorf("results[%d].Cmd.Label = %q, want %q", i, r.Cmd.Label, label)
+		}
+		if string(r.Stdout) != "go.mod\n" {
+			t.Errorf("results[%d].Stdout = %q", i, r.Stdout)
+		}
+	}
+}
+
+func TestModuleCmdsShared(t *testing.T) {
+	var out bytes.Buffer
+	tmpl := &Cmd{Path: "echo", Args: []string{"x"}, Stdout: &out, Stderr: &out}
+	root := t.TempDir()
+	cmds := ModuleCmds(root, []string{root, root, root, root}, tmpl)
+	cmds[0].Args[0] = "y"
+	if tmpl.Args[0] != "x" {
+		t.Errorf("template args changed to %q", tmpl.Args)
+	}
+	if _, err := (&Batch{Cmds: cmds}).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); len(got) != 8 {
+		t.Errorf("output %q, want 4 lines", got)
+	}
+}
@@ -0,0 +1,249 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Summary sums up a run of a Batch for notifiers.
+type Summary struct {
+	RunID  string
+	Start  time.Time
+	End    time.Time
+	Failed bool
+
+	// Seed is the seed of the order of the commands, if shuffled.
+	Seed int64 `json:",omitempty"`
+
+	// CoverProfile is the merged coverage profile of the commands, if
+	// Batch.CoverDir is set.
+	CoverProfile string `json:",omitempty"`
+
+	// Counts holds the number of commands by status.
+	Counts  map[Status]int
+	Results []ResultSummary
+}
+
+// ResultSummary sums up a Result.
+type ResultSummary struct {
+	Label    string
+	Status   Status
+	ExitCode int
+	Seconds  float64
+	Err      string `json:",omitempty"`
+
+	Artifacts []Artifact `json:",omitempty"`
+
+	// Change is the change in the output of the command, if compared,
+	// its diff truncated to 4 KiB.
+	Change *Change `json:",omitempty"`
+}
+
+// maxSummaryDiff bounds the size of the diffs in a Summary.
+const maxSummaryDiff = 4 << 10
+
+// NewSummary returns the summary of the results of the batch run runID
+// that started at start.
+func NewSummary(runID string, start time.Time, results []*Result) *Summary {
+	s := &Summary{
+		RunID:  runID,
+		Start:  start,
+		End:    time.Now(),
+		Counts: make(map[Status]int),
+	}
+	for _, r := range results {
+		rs := ResultSummary{
+			Label:    r.Cmd.name(),
+			Status:   r.Status,
+			ExitCode: r.ExitCode,
+			Seconds:  r.Duration().Seconds(),
+
+			Artifacts: r.Artifacts,
+		}
+		if r.Change != nil {
+			ch := *r.Change
+			ch.Diff = truncateDiff(ch.Diff, maxSummaryDiff)
+			rs.Change = &ch
+		}
+		if r.Err != nil {
+			rs.Err = r.Err.Error()
+			s.Failed = true
+		}
+		s.Counts[r.Status]++
+		s.Results = append(s.Results, rs)
+	}
+	return s
+}
+
+// truncateDiff truncates diff to at most max bytes, at a line boundary,
+// noting the lines left out.
+func truncateDiff(diff string, max int) string {
+	if len(diff) <= max {
+		return diff
+	}
+	i := strings.LastIndexByte(diff[:max], '\n') + 1
+	return diff[:i] + fmt.Sprintf("... %d more lines\n", strings.Count(diff[i:], "\n"))
+}
+
+// Notifier is notified of the completion of a batch.
+type Notifier interface {
+	Notify(ctx context.Context, s *Summary) error
+}
+
+// WebhookNotifier posts the Summary, encoded in JSON, to URL.
+type WebhookNotifier struct {
+	URL    string
+	Header http.Header
+
+	// Client is the client used for the request, http.DefaultClient
+	// if nil.
+	Client *http.Client
+
+	// OnFailure only notifies the batches that failed.
+	OnFailure bool
+
+	// Retries is the number of times a failed request is retried, after
+	// waiting RetryDelay. Timeout, if not zero, bounds each attempt.
+	Retries    int
+	RetryDelay time.Duration
+	Timeout    time.Duration
+}
+
+// Notify posts s to n.URL. A response status other than 2xx is an
+// error.
+func (n *WebhookNotifier) Notify(ctx context.Context, s *Summary) error {
+	if n.OnFailure && !s.Failed {
+		return nil
+	}
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return retry(ctx, n.Retries, n.RetryDelay, n.Timeout, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for k, v := range n.Header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook %s: %s", n.URL, resp.Status)
+		}
+		return nil
+	})
+}
+
+// Environment variables set for the command of a CmdNotifier.
+const (
+	EnvStatus      = "COMMAND_STATUS"       // "ok" or "failed"
+	EnvTotal       = "COMMAND_TOTAL"        // number of commands
+	EnvFailed      = "COMMAND_FAILED"       // number of failed commands
+	EnvSeconds     = "COMMAND_SECONDS"      // duration of the batch
+	EnvSummaryFile = "COMMAND_SUMMARY_FILE" // a file holding the Summary, encoded in JSON
+)
+
+// CmdNotifier runs Cmd with the Summary in its environment, along with
+// the RunID of the batch in COMMAND_RUN_ID. The Summary itself is
+// written to a temporary file, removed once Cmd is done, since it can
+// exceed the size limit of an environment variable.
+type CmdNotifier struct {
+	Cmd *Cmd
+
+	// OnFailure only notifies the batches that failed.
+	OnFailure bool
+
+	// Retries is the number of times a failed command is run again,
+	// after waiting RetryDelay. Timeout, if not zero, bounds each
+	// attempt, in addition to Cmd.Timeout.
+	Retries    int
+	RetryDelay time.Duration
+	Timeout    time.Duration
+}
+
+// Notify runs n.Cmd.
+func (n *CmdNotifier) Notify(ctx context.Context, s *Summary) error {
+	if n.OnFailure && !s.Failed {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "command-summary-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	status, failed := "ok", 0
+	for _, r := range s.Results {
+		if r.Err != "" {
+			status = "failed"
+			failed++
+		}
+	}
+	c := *n.Cmd
+	if c.Env == nil {
+		c.Env = os.Environ()
+	}
+	c.Env = append(c.Env[:len(c.Env):len(c.Env)],
+		EnvStatus+"="+status,
+		EnvTotal+"="+strconv.Itoa(len(s.Results)),
+		EnvFailed+"="+strconv.Itoa(failed),
+		EnvSeconds+"="+strconv.FormatFloat(s.End.Sub(s.Start).Seconds(), 'f', 3, 64),
+		EnvSummaryFile+"="+f.Name(),
+	)
+	return retry(ctx, n.Retries, n.RetryDelay, n.Timeout, func(ctx context.Context) error {
+		_, err := (&Batch{Cmds: []*Cmd{&c}, RunID: s.RunID}).Run(ctx)
+		return err
+	})
+}
+
+// retry calls f until it succeeds, at most retries+1 times, waiting
+// delay between calls. If timeout is not zero, it bounds each call.
+func retry(ctx context.Context, retries int, delay, timeout time.Duration, f func(context.Context) error) error {
+	var err error
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout != 0 {
+			actx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		err = f(actx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
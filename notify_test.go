@@ -0,0 +1,103 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var calls int
+	var got Summary
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	b := &Batch{
+		Cmds:      []*Cmd{{Label: "ok", Path: "true"}, {Label: "bad", Path: "false"}},
+		RunID:     "run1",
+		Notifiers: []Notifier{&WebhookNotifier{URL: srv.URL, Retries: 1}},
+	}
+	if _, err := b.Run(context.Background()); err == nil {
+		t.Fatal("expected error")
+	}
+	if calls != 2 {
+		t.Errorf("%d calls, want 2", calls)
+	}
+	if got.RunID != "run1" || !got.Failed || got.Counts[StatusOK] != 1 || got.Counts[StatusFailed] != 1 {
+		t.Errorf("got summary %+v", got)
+	}
+}
+
+func TestSummaryChange(t *testing.T) {
+	diff := strings.Repeat("-old\n+new\n", 1000)
+	r := &Result{Cmd: &Cmd{Label: "a"}, Change: &Change{PrevExitCode: 0, ExitCode: 1, Diff: diff}}
+	s := NewSummary("run1", time.Now(), []*Result{r})
+	ch := s.Results[0].Change
+	if ch == nil || ch.PrevExitCode != 0 || ch.ExitCode != 1 {
+		t.Fatalf("change %+v, want exit code change", ch)
+	}
+	if len(ch.Diff) > maxSummaryDiff+32 || !strings.HasPrefix(ch.Diff, "-old\n+new\n") || !strings.HasSuffix(ch.Diff, "more lines\n") {
+		t.Errorf("diff not truncated: %d bytes, ending %q", len(ch.Diff), ch.Diff[len(ch.Diff)-20:])
+	}
+	if r.Change.Diff != diff {
+		t.Error("result diff truncated")
+	}
+}
+
+func TestCmdNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	n := &CmdNotifier{
+		Cmd: &Cmd{Path: "sh", Args: []string{"-c", `echo $COMMAND_RUN_ID $COMMAND_STATUS $COMMAND_TOTAL >` + out}},
+	}
+	b := &Batch{Cmds: []*Cmd{NewCmd("true", 0)}, RunID: "run1", Notifiers: []Notifier{n}}
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "run1 ok 1" {
+		t.Errorf("got %q, want %q", got, "run1 ok 1")
+	}
+
+	// A summary too large for the environment.
+	s := &Summary{RunID: "run2", Results: []ResultSummary{{Label: "big", Err: strings.Repeat("x", 256<<10)}}}
+	n.Cmd = &Cmd{Path: "sh", Args: []string{"-c", `cp "$COMMAND_SUMMARY_FILE" ` + out}}
+	if err := n.Notify(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	var got Summary
+	if data, err := os.ReadFile(out); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.RunID != "run2" || len(got.Results[0].Err) != 256<<10 {
+		t.Errorf("got summary of run %q", got.RunID)
+	}
+
+	n.OnFailure = true
+	os.Remove(out)
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("notified a successful batch with OnFailure")
+	}
+}
@@ -0,0 +1,81 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Error is the error of a command that failed, or whose output could not
+// be decoded, with its standard error.
+type Error struct {
+	Label  string
+	Err    error
+	Stderr []byte
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Label, e.Err)
+	if s := bytes.TrimSpace(e.Stderr); len(s) > 0 {
+		msg += ": " + string(s)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// RunOutput runs c and returns its standard output. If c fails, the
+// error is an *Error holding its standard error.
+func RunOutput(ctx context.Context, c *Cmd) ([]byte, error) {
+	return RunDecode(ctx, c, func(data []byte) ([]byte, error) {
+		return data, nil
+	})
+}
+
+// RunDecode runs c and decodes its standard output with decode. If c
+// cannot be run, fails or decode returns an error, the error is an
+// *Error holding the standard error of c.
+func RunDecode[T any](ctx context.Context, c *Cmd, decode func([]byte) (T, error)) (T, error) {
+	var zero T
+	results, err := (&Batch{Cmds: []*Cmd{c}, Capture: true}).Run(ctx)
+	if results == nil {
+		return zero, &Error{Label: c.name(), Err: err}
+	}
+	r := results[0]
+	if r.Err != nil {
+		return zero, &Error{Label: c.name(), Err: r.Err, Stderr: r.Stderr}
+	}
+	v, err := decode(r.Stdout)
+	if err != nil {
+		return zero, &Error{Label: c.name(), Err: fmt.Errorf("decode output: %w", err), Stderr: r.Stderr}
+	}
+	return v, nil
+}
+
+// RunJSON runs c and decodes its standard output as JSON into a T.
+//
+//	type module struct{ Path, Dir string }
+//	mod, err := RunJSON[module](ctx, NewCmd("go", 0, "list", "-m", "-json"))
+func RunJSON[T any](ctx context.Context, c *Cmd) (T, error) {
+	return RunDecode(ctx, c, func(data []byte) (T, error) {
+		var v T
+		err := json.Unmarshal(data, &v)
+		return v, err
+	})
+}
+
+// RunLines runs c and returns the lines of its standard output, without
+// their line endings.
+func RunLines(ctx context.Context, c *Cmd) ([]string, error) {
+	return RunDecode(ctx, c, func(data []byte) ([]string, error) {
+		s := strings.TrimSuffix(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+		if s == "" {
+			return nil, nil
+		}
+		return strings.Split(s, "\n"), nil
+	})
+}
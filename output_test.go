@@ -0,0 +1,48 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunJSON(t *testing.T) {
+	type point struct{ X, Y int }
+	p, err := RunJSON[point](context.Background(), NewCmd("echo", 0, `{"X": 1, "Y": 2}`))
+	if err != nil || p != (point{1, 2}) {
+		t.Errorf("got %v, %v", p, err)
+	}
+
+	_, err = RunJSON[point](context.Background(), NewCmd("echo", 0, "nope"))
+	var e *Error
+	if !errors.As(err, &e) || !strings.Contains(e.Error(), "decode output") {
+		t.Errorf("err = %v, want decode *Error", err)
+	}
+}
+
+func TestRunLines(t *testing.T) {
+	lines, err := RunLines(context.Background(), NewCmd("printf", 0, `a\nb\n`))
+	if want := []string{"a", "b"}; err != nil || !reflect.DeepEqual(lines, want) {
+		t.Errorf("got %q, %v, want %q", lines, err, want)
+	}
+
+	_, err = RunLines(context.Background(), &Cmd{Label: "fail", Path: "sh", Args: []string{"-c", "echo oops >&2; exit 3"}})
+	var e *Error
+	if !errors.As(err, &e) || string(e.Stderr) != "oops\n" {
+		t.Fatalf("err = %v, want *Error with stderr", err)
+	}
+	if got, want := e.Error(), "fail: exit status 3: oops"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestRunOutputSetupError(t *testing.T) {
+	t.Setenv("COMMAND_TIMEOUT_SCALE", "fast")
+	_, err := RunLines(context.Background(), NewCmd("echo", 0, "a"))
+	var e *Error
+	if !errors.As(err, &e) || !strings.Contains(err.Error(), "COMMAND_TIMEOUT_SCALE") {
+		t.Errorf("err = %v, want *Error about the timeout scale", err)
+	}
+}
@@ -0,0 +1,263 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Pool shares a number of concurrency slots between the batches of
+// several tenants, as set by Batch.Pool and Batch.Tenant.
+//
+// When a slot is free, it goes to the waiting command of highest
+// Cmd.Priority. Among those, it goes to the first command of the tenant
+// with the fewest running commands relative to its weight, so that each
+// busy tenant gets its weighted share of the slots.
+//
+// A Pool must not be copied after first use.
+type Pool struct {
+	// Slots is the number of commands that may run at once,
+	// across all tenants. Zero means no limit, the tenant quotas
+	// still applying.
+	Slots int
+
+	// Tenants configures the tenants by name. Tenants that are not
+	// listed have a weight of 1 and no quotas.
+	Tenants map[string]Tenant
+
+	// Preempt enables preemption: when a command finds all slots taken,
+	// the running Cmd.Preemptible command of lowest priority, if lower
+	// than its own, is sent SIGTERM, killed after GracePeriod if still
+	// running, and queued again.
+	Preempt bool
+
+	// MaxPreemptions is the number of times a command may be preempted,
+	// 1 if zero.
+	MaxPreemptions int
+
+	// GracePeriod is the time given to a preempted command to exit,
+	// 10 seconds if zero.
+	GracePeriod time.Duration
+
+	mu      sync.Mutex
+	total   int
+	running map[string]int
+	queue   []*ticket // in arrival order
+	active  []*ticket // in start order
+}
+
+// Tenant configures the share of a Pool given to a tenant.
+type Tenant struct {
+	// Weight is the share of the slots given to the tenant relative to
+	// the other tenants, 1 if zero.
+	Weight int
+
+	// MaxRunning limits the number of running commands of the tenant.
+	// Zero means no limit.
+	MaxRunning int
+
+	// MaxQueued limits the number of commands of the tenant waiting for
+	// a slot. Commands over the limit are rejected with ErrQueueFull.
+	// Zero means no limit.
+	MaxQueued int
+}
+
+// ErrQueueFull is the error of a command rejected, with StatusRejected,
+// because its tenant has too many commands waiting in the Pool.
+var ErrQueueFull = errors.New("command: tenant queue full")
+
+// ticket is the place of a command in a Pool.
+type ticket struct {
+	pool        *Pool
+	tenant      string
+	priority    int
+	preemptible bool
+	preemptions int
+	ready       chan struct{} // closed when given a slot
+	stop        chan struct{} // closed when preempted
+	stopped     bool
+}
+
+// enqueue queues command c of tenant for a slot.
+func (p *Pool) enqueue(tenant string, c *Cmd) (*ticket, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if max := p.tenant(tenant).MaxQueued; max > 0 && p.queued(tenant) >= max {
+		return nil, fmt.Errorf("%w: %q has %d commands queued", ErrQueueFull, tenant, max)
+	}
+	t := &ticket{
+		pool:        p,
+		tenant:      tenant,
+		priority:    c.Priority,
+		preemptible: c.Preemptible,
+		ready:       make(chan struct{}),
+	}
+	p.queue = append(p.queue, t)
+	p.dispatch()
+	if p.Preempt && p.full() {
+		select {
+		case <-t.ready:
+		default:
+			p.preempt(t.priority)
+		}
+	}
+	return t, nil
+}
+
+// requeue queues t again after it was preempted.
+func (t *ticket) requeue() {
+	p := t.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t.ready = make(chan struct{})
+	t.stopped = false
+	t.preemptions++
+	p.queue = append(p.queue, t)
+	p.dispatch()
+}
+
+// preempt stops the running command of lowest priority below priority,
+// if any is preemptible. p.mu must be held.
+func (p *Pool) preempt(priority int) {
+	max := p.MaxPreemptions
+	if max == 0 {
+		max = 1
+	}
+	var victim *ticket
+	for _, t := range p.active {
+		if !t.preemptible || t.stopped || t.preemptions >= max || t.priority >= priority {
+			continue
+		}
+		// Prefer the latest started, which loses the least work.
+		if victim == nil || t.priority <= victim.priority {
+			victim = t
+		}
+	}
+	if victim != nil {
+		victim.stopped = true
+		close(victim.stop)
+	}
+}
+
+// gracePeriod returns the time given to a stopped command to exit.
+// p may be nil.
+func (p *Pool) gracePeriod() time.Duration {
+	if p == nil || p.GracePeriod == 0 {
+		return 10 * time.Second
+	}
+	return p.GracePeriod
+}
+
+// wait waits for t to be given a slot. The slot must be released with
+// t.release.
+func (t *ticket) wait(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	t.abandon()
+	return ctx.Err()
+}
+
+// abandon removes t from the queue, or releases its slot if it was
+// given one.
+func (t *ticket) abandon() {
+	p := t.pool
+	p.mu.Lock()
+	for i, q := range p.queue {
+		if q == t {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			p.mu.Unlock()
+			return
+		}
+	}
+	p.mu.Unlock()
+	t.release()
+}
+
+// release frees the slot of t.
+func (t *ticket) release() {
+	p := t.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, a := range p.active {
+		if a == t {
+			p.active = append(p.active[:i], p.active[i+1:]...)
+			break
+		}
+	}
+	p.running[t.tenant]--
+	p.total--
+	p.dispatch()
+}
+
+// dispatch gives the free slots to the waiting commands.
+// p.mu must be held.
+func (p *Pool) dispatch() {
+	if p.running == nil {
+		p.running = make(map[string]int)
+	}
+	for !p.full() {
+		best := -1
+		for i, t := range p.queue {
+			cfg := p.tenant(t.tenant)
+			if cfg.MaxRunning > 0 && p.running[t.tenant] >= cfg.MaxRunning {
+				continue
+			}
+			if best < 0 || p.before(t, p.queue[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return
+		}
+		t := p.queue[best]
+		p.queue = append(p.queue[:best], p.queue[best+1:]...)
+		p.running[t.tenant]++
+		p.total++
+		p.active = append(p.active, t)
+		t.stop = make(chan struct{})
+		close(t.ready)
+	}
+}
+
+// full reports whether all slots are taken. p.mu must be held.
+func (p *Pool) full() bool {
+	return p.Slots > 0 && p.total >= p.Slots
+}
+
+// before reports whether t should get a slot before u, which arrived
+// earlier.
+func (p *Pool) before(t, u *ticket) bool {
+	if t.priority != u.priority {
+		return t.priority > u.priority
+	}
+	return p.share(t.tenant) < p.share(u.tenant)
+}
+
+// share returns the number of running commands of tenant relative to
+// its weight.
+func (p *Pool) share(tenant string) float64 {
+	w := p.tenant(tenant).Weight
+	if w <= 0 {
+		w = 1
+	}
+	return float64(p.running[tenant]) / float64(w)
+}
+
+func (p *Pool) queued(tenant string) int {
+	n := 0
+	for _, t := range p.queue {
+		if t.tenant == tenant {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *Pool) tenant(name string) Tenant {
+	return p.Tenants[name]
+}
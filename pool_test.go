@@ -0,0 +1,168 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolFairShare(t *testing.T) {
+	p := &Pool{
+		Slots: 1,
+		Tenants: map[string]Tenant{
+			"a": {Weight: 2},
+			"b": {MaxQueued: 3},
+		},
+	}
+	// Take the only slot, so that the others queue.
+	if _, err := p.enqueue("z", &Cmd{}); err != nil {
+		t.Fatal(err)
+	}
+	var as, bs []*ticket
+	for i := 0; i < 4; i++ {
+		tk, err := p.enqueue("a", &Cmd{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		as = append(as, tk)
+	}
+	for i := 0; i < 4; i++ {
+		tk, err := p.enqueue("b", &Cmd{})
+		if i == 3 {
+			if !errors.Is(err, ErrQueueFull) {
+				t.Fatalf("err = %v, want ErrQueueFull", err)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs = append(bs, tk)
+	}
+
+	p.mu.Lock()
+	p.Slots = 4
+	p.dispatch()
+	p.mu.Unlock()
+	if p.running["a"] != 2 || p.running["b"] != 1 {
+		t.Fatalf("running = %v, want a:2 b:1", p.running)
+	}
+	as[0].release()
+	if p.running["a"] != 2 || p.running["b"] != 1 {
+		t.Fatalf("running = %v, want a:2 b:1", p.running)
+	}
+	if err := bs[0].wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := bs[1].wait(ctx); err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if n := p.queued("b"); n != 1 {
+		t.Errorf("%d commands of b queued, want 1", n)
+	}
+}
+
+func TestBatchPool(t *testing.T) {
+	p := &Pool{Slots: 4, Tenants: map[string]Tenant{"a": {MaxRunning: 1}}}
+	b := &Batch{
+		Cmds:   []*Cmd{NewCmd("true", 0), NewCmd("true", 0), NewCmd("true", 0)},
+		Pool:   p,
+		Tenant: "a",
+	}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Start.Before(results[i-1].End) {
+			t.Errorf("commands %d and %d overlap", i-1, i)
+		}
+	}
+}
+
+func TestBatchPoolUnlimited(t *testing.T) {
+	b := &Batch{Cmds: []*Cmd{NewCmd("true", 0), NewCmd("true", 0)}, Pool: &Pool{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := b.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPoolPreempt(t *testing.T) {
+	p := &Pool{Slots: 1, Preempt: true}
+	low := &Batch{Cmds: []*Cmd{{Path: "sleep", Args: []string{"1"}, Preemptible: true}}, Pool: p}
+	high := &Batch{Cmds: []*Cmd{{Path: "true", Priority: 1}}, Pool: p}
+
+	done := make(chan []*Result)
+	go func() {
+		results, _ := low.Run(context.Background())
+		done <- results
+	}()
+	for {
+		p.mu.Lock()
+		n := len(p.active)
+		p.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	hr, err := high.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lr := <-done
+	if lr[0].Err != nil {
+		t.Fatal(lr[0].Err)
+	}
+	if lr[0].Preemptions != 1 {
+		t.Errorf("low: %d preemptions, want 1", lr[0].Preemptions)
+	}
+	if !hr[0].End.Before(lr[0].Start) {
+		t.Errorf("low command not run again after high one")
+	}
+}
+
+func TestPoolPreemptExited(t *testing.T) {
+	p := &Pool{Slots: 1, Preempt: true, GracePeriod: time.Second}
+	b := &Batch{Pool: p}
+	start := func(c *Cmd) *ticket {
+		tk, err := p.enqueue("", c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tk.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return tk
+	}
+	preempt := func() {
+		p.mu.Lock()
+		p.preempt(1)
+		p.mu.Unlock()
+	}
+
+	c := &Cmd{Path: "sleep", Args: []string{"10"}, Preemptible: true}
+	tk := start(c)
+	time.AfterFunc(50*time.Millisecond, preempt)
+	if _, interrupted := b.run(context.Background(), c, 0, tk.stop); !interrupted {
+		t.Error("running command not interrupted")
+	}
+	tk.release()
+
+	// Preempted once exited, before releasing its slot: the command
+	// must not run again.
+	c = &Cmd{Path: "true", Preemptible: true}
+	tk = start(c)
+	r, interrupted := b.run(context.Background(), c, 0, tk.stop)
+	preempt()
+	if r.Err != nil || interrupted {
+		t.Errorf("exited command interrupted: %v", r.Err)
+	}
+	tk.release()
+}
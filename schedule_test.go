@@ -0,0 +1,84 @@
+package command
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEarliestDeadlineFirst(t *testing.T) {
+	now := time.Now()
+	cmds := []*Cmd{
+		{Label: "none", Path: "true"},
+		{Label: "late", Path: "true", Deadline: now.Add(time.Hour)},
+		{Label: "early", Path: "true", Deadline: now.Add(time.Minute)},
+	}
+	b := &Batch{Cmds: cmds, Parallel: 1, EarliestDeadlineFirst: true}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, late, early := results[0], results[1], results[2]
+	if !early.End.Before(late.Start) || !late.End.Before(none.Start) {
+		t.Errorf("commands not run in deadline order")
+	}
+}
+
+func TestSkipMissed(t *testing.T) {
+	h := &History{Dir: t.TempDir()}
+	slow := &Cmd{Label: "slow", Path: "true"}
+	h.Record(&Result{Cmd: slow, End: time.Unix(0, 0).Add(time.Hour), Start: time.Unix(0, 0)})
+	slow.Deadline = time.Now().Add(time.Minute)
+	fast := &Cmd{Label: "fast", Path: "true", Deadline: time.Now().Add(time.Minute)}
+
+	b := &Batch{Cmds: []*Cmd{slow, fast}, SkipMissed: true, History: h}
+	results, err := b.Run(context.Background())
+	if err != ErrDeadlineMissed {
+		t.Errorf("err = %v, want ErrDeadlineMissed", err)
+	}
+	if results[0].Status != StatusDeadlineMissed {
+		t.Errorf("slow: status %v, want %v", results[0].Status, StatusDeadlineMissed)
+	}
+	if results[1].Status != StatusOK {
+		t.Errorf("fast: status %v, want %v", results[1].Status, StatusOK)
+	}
+	if recs, _ := h.Records("fast"); len(recs) != 1 {
+		t.Errorf("fast: %d records, want 1", len(recs))
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	cmds := make([]*Cmd, 20)
+	for i := range cmds {
+		cmds[i] = NewCmd("true", 0)
+	}
+	b := &Batch{Cmds: cmds, Parallel: 1, Shuffle: true}
+	results, s, err := b.RunSummary(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Seed == 0 || b.Seed != 0 {
+		t.Fatalf("seed %d reported, %d set in batch", s.Seed, b.Seed)
+	}
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return results[order[i]].Start.Before(results[order[j]].Start) })
+	sorted := true
+	for i, j := range order {
+		sorted = sorted && i == j
+	}
+	if sorted {
+		t.Errorf("order %v not shuffled", order)
+	}
+	replay := &Batch{Cmds: cmds, Shuffle: true, Seed: s.Seed}
+	if got := replay.order(replay.Seed); !reflect.DeepEqual(got, order) {
+		t.Errorf("replayed order %v, want %v", got, order)
+	}
+	if _, s2, _ := b.RunSummary(context.Background()); s2.Seed == s.Seed {
+		t.Errorf("seed %d reused by next run", s.Seed)
+	}
+}
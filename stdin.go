@@ -0,0 +1,183 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// StdinSwitch routes its input, typically the terminal, to the standard
+// input of one of several concurrent commands at a time, so that one can
+// interact with a debugger or REPL among them. The other commands read
+// nothing until they are selected.
+//
+//	sw := &StdinSwitch{In: os.Stdin}
+//	for _, c := range cmds {
+//		c.Stdin = sw.Stdin(c.Label)
+//	}
+//	go sw.Run()
+//	defer sw.Close()
+//
+// The input selects a command with a line starting with the Escape
+// byte followed by its label, such as "^Aweb" to type into the command
+// labelled "web".
+type StdinSwitch struct {
+	In io.Reader
+
+	// Escape introduces a line selecting a command, 0x01 (Ctrl-A) if
+	// zero.
+	Escape byte
+
+	mu       sync.Mutex
+	pipes    map[string]*stdinPipe
+	selected string
+	closed   bool
+}
+
+type stdinPipe struct {
+	r, w *os.File
+	data chan []byte // written to w, closed by Close
+}
+
+// stdinQueue is the number of reads of the input queued for a command
+// before more input for it is dropped.
+const stdinQueue = 64
+
+// copy writes the queued input to p.w until the queue is closed.
+func (p *stdinPipe) copy() {
+	for b := range p.data {
+		// Errors, such as the command having exited, are ignored.
+		p.w.Write(b)
+	}
+}
+
+// Stdin returns the standard input of the command labelled label. The
+// first command registered is selected.
+func (s *StdinSwitch) Stdin(label string) *os.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.pipes[label]; ok {
+		return p.r
+	}
+	p := new(stdinPipe)
+	var err error
+	if p.r, p.w, err = os.Pipe(); err != nil {
+		// Fall back to no input, as for a nil Cmd.Stdin.
+		p.r, _ = os.Open(os.DevNull)
+	} else {
+		p.data = make(chan []byte, stdinQueue)
+		go p.copy()
+	}
+	if s.pipes == nil {
+		s.pipes = make(map[string]*stdinPipe)
+		s.selected = label
+	}
+	s.pipes[label] = p
+	return p.r
+}
+
+// Select routes the input to the command labelled label.
+func (s *StdinSwitch) Select(label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pipes[label]; !ok {
+		return fmt.Errorf("command: no stdin for %q", label)
+	}
+	s.selected = label
+	return nil
+}
+
+// Selected returns the label of the selected command.
+func (s *StdinSwitch) Selected() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.selected
+}
+
+// Run copies s.In to the selected command until s.In ends.
+// Lines selecting an unknown command are ignored.
+func (s *StdinSwitch) Run() error {
+	esc := s.Escape
+	if esc == 0 {
+		esc = 0x01
+	}
+	var (
+		buf      = make([]byte, 4096)
+		label    []byte
+		inSelect bool
+	)
+	for {
+		n, err := s.In.Read(buf)
+		data := buf[:n]
+		for len(data) > 0 {
+			if inSelect {
+				i := bytes.IndexByte(data, '\n')
+				if i < 0 {
+					label = append(label, data...)
+					break
+				}
+				label = append(label, data[:i]...)
+				s.Select(strings.TrimSpace(string(label)))
+				label, inSelect = label[:0], false
+				data = data[i+1:]
+				continue
+			}
+			i := bytes.IndexByte(data, esc)
+			if i < 0 {
+				s.write(data)
+				break
+			}
+			s.write(data[:i])
+			inSelect = true
+			data = data[i+1:]
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write queues p for the selected command without blocking, so that
+// the input can still select another command. Input the command does not
+// read in time, such as after it exited, is dropped once its queue is
+// full.
+func (s *StdinSwitch) write(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pipe := s.pipes[s.selected]
+	if pipe == nil || pipe.data == nil || s.closed {
+		return
+	}
+	select {
+	case pipe.data <- append([]byte(nil), p...):
+	default:
+	}
+}
+
+// Close closes the standard input of all commands. The input queued for
+// them is dropped.
+func (s *StdinSwitch) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	for _, p := range s.pipes {
+		p.r.Close()
+		if p.data != nil {
+			close(p.data)
+			p.w.Close()
+		}
+	}
+	return nil
+}
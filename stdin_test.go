@@ -0,0 +1,62 @@
+package command
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStdinSwitch(t *testing.T) {
+	sw := &StdinSwitch{In: strings.NewReader("to a\n\x01b\nto b\n")}
+	defer sw.Close()
+	cmds := []*Cmd{
+		{Label: "a", Path: "head", Args: []string{"-n1"}},
+		{Label: "b", Path: "head", Args: []string{"-n1"}},
+	}
+	for _, c := range cmds {
+		c.Stdin = sw.Stdin(c.Label)
+	}
+	if err := sw.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sw.Selected(); got != "b" {
+		t.Errorf("selected %q, want b", got)
+	}
+	results, err := (&Batch{Cmds: cmds, Capture: true}).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"to a\n", "to b\n"} {
+		if got := string(results[i].Stdout); got != want {
+			t.Errorf("%s read %q, want %q", cmds[i].Label, got, want)
+		}
+	}
+}
+
+func TestStdinSwitchStalled(t *testing.T) {
+	// a never reads its input, which must not keep b from being
+	// selected.
+	in := strings.Repeat("x", 1<<20) + "\x01b\nto b\n"
+	sw := &StdinSwitch{In: strings.NewReader(in)}
+	defer sw.Close()
+	sw.Stdin("a")
+	b := &Cmd{Label: "b", Path: "head", Args: []string{"-n1"}, Stdin: sw.Stdin("b")}
+	done := make(chan error)
+	go func() { done <- sw.Run() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run blocked on a")
+	}
+	results, err := (&Batch{Cmds: []*Cmd{b}, Capture: true}).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(results[0].Stdout); got != "to b\n" {
+		t.Errorf("b read %q, want %q", got, "to b\n")
+	}
+}
@@ -0,0 +1,162 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Stream connects the output of a command of a Batch to the input of
+// another, through a pipe. A command may feed several others, each
+// receiving all of its output.
+type Stream struct {
+	// From and To are the labels of the producer and the consumer.
+	From string
+	To   string
+
+	// Stderr streams the standard error of From instead of its
+	// standard output.
+	Stderr bool
+
+	// Arg, if not empty, is an argument of To replaced by the path of
+	// the pipe, as in the process substitution <(...) of shells, instead
+	// of connecting the pipe to the standard input of To.
+	Arg string
+}
+
+// wires holds the pipe ends of the streams of a batch, by command.
+// The nil wires holds none.
+type wires map[*Cmd]*wire
+
+type wire struct {
+	once    sync.Once
+	onStart []*os.File // closed once the command started
+	onExit  []*os.File // closed once the command exited
+}
+
+var errStreamPool = errors.New("command: stream: cannot be used with a Pool")
+
+// connect returns copies of cmds connected by streams.
+func connect(cmds []*Cmd, streams []Stream) ([]*Cmd, wires, error) {
+	wired := append([]*Cmd(nil), cmds...)
+	byLabel := make(map[string]int)
+	for i, c := range cmds {
+		byLabel[c.name()] = i
+	}
+	ws := make(wires)
+	get := func(label string) (*Cmd, *wire, error) {
+		i, ok := byLabel[label]
+		if !ok {
+			return nil, nil, fmt.Errorf("command: stream: no command %q", label)
+		}
+		if ws[wired[i]] == nil {
+			c := *cmds[i]
+			c.Args = append([]string(nil), c.Args...)
+			wired[i] = &c
+			ws[&c] = new(wire)
+		}
+		return wired[i], ws[wired[i]], nil
+	}
+
+	outs := make(map[*Cmd][2][]io.Writer)
+	for _, s := range streams {
+		from, fw, err := get(s.From)
+		if err != nil {
+			ws.closeAll()
+			return nil, nil, err
+		}
+		to, tw, err := get(s.To)
+		if err != nil {
+			ws.closeAll()
+			return nil, nil, err
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			ws.closeAll()
+			return nil, nil, err
+		}
+		fw.onExit = append(fw.onExit, w)
+		tw.onStart = append(tw.onStart, r)
+		if err := to.input(s, r); err != nil {
+			ws.closeAll()
+			return nil, nil, err
+		}
+		o := outs[from]
+		if s.Stderr {
+			o[1] = append(o[1], w)
+		} else {
+			o[0] = append(o[0], w)
+		}
+		outs[from] = o
+	}
+	for c, o := range outs {
+		c.Stdout = fanOut(c.Stdout, o[0])
+		c.Stderr = fanOut(c.Stderr, o[1])
+	}
+	return wired, ws, nil
+}
+
+// input connects r, the read end of the pipe of s, to c.
+func (c *Cmd) input(s Stream, r *os.File) error {
+	if s.Arg == "" {
+		if c.Stdin != nil {
+			return fmt.Errorf("command: stream: %q has several inputs", s.To)
+		}
+		c.Stdin = r
+		return nil
+	}
+	for i, a := range c.Args {
+		if a == s.Arg {
+			c.ExtraFiles = append(c.ExtraFiles, r)
+			c.Args[i] = "/dev/fd/" + strconv.Itoa(2+len(c.ExtraFiles))
+			return nil
+		}
+	}
+	return fmt.Errorf("command: stream: %q has no argument %q", s.To, s.Arg)
+}
+
+// fanOut returns a writer writing to w, if not nil, and to all pipes.
+func fanOut(w io.Writer, pipes []io.Writer) io.Writer {
+	if len(pipes) == 0 {
+		return w
+	}
+	if w == nil && len(pipes) == 1 {
+		return pipes[0]
+	}
+	if w != nil {
+		pipes = append([]io.Writer{w}, pipes...)
+	}
+	return io.MultiWriter(pipes...)
+}
+
+// started closes the pipe ends of c that only c needed to inherit.
+func (ws wires) started(c *Cmd) {
+	if w := ws[c]; w != nil {
+		for _, f := range w.onStart {
+			f.Close()
+		}
+	}
+}
+
+// close closes all pipe ends of c, once it exited or will not run, so
+// that the commands at the other ends see the end of the stream.
+func (ws wires) close(c *Cmd) {
+	w := ws[c]
+	if w == nil {
+		return
+	}
+	w.once.Do(func() {
+		for _, f := range append(w.onStart, w.onExit...) {
+			f.Close()
+		}
+	})
+}
+
+func (ws wires) closeAll() {
+	for c := range ws {
+		ws.close(c)
+	}
+}
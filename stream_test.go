@@ -0,0 +1,81 @@
+package command
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStreams(t *testing.T) {
+	b := &Batch{
+		Cmds: []*Cmd{
+			{Label: "sort", Path: "sort"},
+			{Label: "cat", Path: "cat", Args: []string{"<in>"}},
+			{Label: "gen", Path: "printf", Args: []string{`b\na\n`}},
+		},
+		Streams: []Stream{
+			{From: "gen", To: "sort"},
+			{From: "gen", To: "cat", Arg: "<in>"},
+		},
+		Capture: true,
+	}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"a\nb\n", "b\na\n"} {
+		if got := string(results[i].Stdout); got != want {
+			t.Errorf("%s: got %q, want %q", results[i].Cmd.Label, got, want)
+		}
+	}
+	if results[1].Cmd != b.Cmds[1] || len(b.Cmds[1].ExtraFiles) != 0 {
+		t.Error("Cmds modified")
+	}
+}
+
+func TestStreamFailure(t *testing.T) {
+	b := &Batch{
+		Cmds: []*Cmd{
+			{Label: "gen", Path: "sh", Args: []string{"-c", "echo partial; exit 1"}},
+			{Label: "wc", Path: "wc", Args: []string{"-l"}},
+		},
+		Streams: []Stream{{From: "gen", To: "wc"}},
+	}
+	results, err := b.Run(context.Background())
+	if err == nil || results[0].Status != StatusFailed || results[1].Status != StatusOK {
+		t.Errorf("got %v, %v, %v", err, results[0].Status, results[1].Status)
+	}
+
+	b.Streams = []Stream{{From: "gen", To: "nope"}}
+	if _, err := b.Run(context.Background()); err == nil {
+		t.Error("no error for unknown label")
+	}
+}
+
+func TestStreamsLimited(t *testing.T) {
+	b := &Batch{
+		Cmds: []*Cmd{
+			{Label: "sort", Path: "sort"},
+			{Label: "echo", Path: "echo", Args: []string{"x"}},
+			{Label: "other", Path: "true"},
+		},
+		Streams:  []Stream{{From: "echo", To: "sort"}},
+		Parallel: 1,
+		Capture:  true,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := b.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(results[0].Stdout); got != "x\n" {
+		t.Errorf("sort: got %q", got)
+	}
+
+	// Streams would bypass the quotas of a Pool.
+	b.Parallel, b.Pool = 0, &Pool{Slots: 1}
+	if _, err := b.Run(ctx); err != errStreamPool {
+		t.Errorf("err = %v, want %v", err, errStreamPool)
+	}
+}
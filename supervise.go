@@ -0,0 +1,224 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ParseProcfile parses the commands of a Procfile: each non-empty line
+// not starting with "#" has the form "label: command line", the command
+// line being run by sh -c.
+func ParseProcfile(r io.Reader) ([]*Cmd, error) {
+	return parseProcfile(r, true)
+}
+
+// parseProcfile parses a Procfile, failing on duplicate labels if
+// strict.
+func parseProcfile(r io.Reader, strict bool) ([]*Cmd, error) {
+	var cmds []*Cmd
+	seen := make(map[string]bool)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("procfile:%d: missing label", n)
+		}
+		label, cmdline := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if strict && seen[label] {
+			return nil, fmt.Errorf("procfile:%d: duplicate label %q", n, label)
+		}
+		seen[label] = true
+		cmds = append(cmds, &Cmd{Label: label, Path: "sh", Args: []string{"-c", cmdline}})
+	}
+	return cmds, s.Err()
+}
+
+// CmdDiff lists, by label, the differences between two sets of commands.
+type CmdDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// DiffCmds compares the commands of old and new by label. A command is
+// changed if its Path, Args, Env or Dir differ.
+func DiffCmds(old, new []*Cmd) CmdDiff {
+	var d CmdDiff
+	prev := make(map[string]*Cmd)
+	for _, c := range old {
+		prev[c.name()] = c
+	}
+	for _, c := range new {
+		o, ok := prev[c.name()]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, c.name())
+		case !sameCmd(o, c):
+			d.Changed = append(d.Changed, c.name())
+		}
+		delete(prev, c.name())
+	}
+	for label := range prev {
+		d.Removed = append(d.Removed, label)
+	}
+	sort.Strings(d.Removed)
+	return d
+}
+
+func sameCmd(a, b *Cmd) bool {
+	return a.Path == b.Path && a.Dir == b.Dir &&
+		reflect.DeepEqual(a.Args, b.Args) && reflect.DeepEqual(a.Env, b.Env)
+}
+
+// Supervisor keeps a set of long-running commands running, restarting
+// them when they exit, and applies changes to the set without
+// disturbing the unchanged commands.
+type Supervisor struct {
+	// RestartDelay is the time waited before restarting a command that
+	// exited, 1 second if zero.
+	RestartDelay time.Duration
+
+	// Stdout and Stderr are used for the commands that have none.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	apply sync.Mutex // serializes Apply
+	mu    sync.Mutex
+	batch Batch
+	procs map[string]*proc
+}
+
+type proc struct {
+	cmd  *Cmd
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Apply makes cmds the set of supervised commands: added commands are
+// started, removed ones are stopped, and changed ones are restarted.
+// Commands are stopped with SIGTERM, and killed if they have not exited
+// after 10 seconds, all at once. Changed commands are started again
+// once all stopped commands exited. The commands run until ctx is done
+// or Stop is called.
+func (s *Supervisor) Apply(ctx context.Context, cmds []*Cmd) CmdDiff {
+	s.apply.Lock()
+	defer s.apply.Unlock()
+	s.mu.Lock()
+	if s.procs == nil {
+		s.procs = make(map[string]*proc)
+		s.batch.RunID = newRunID()
+	}
+	old := make([]*Cmd, 0, len(s.procs))
+	for _, p := range s.procs {
+		old = append(old, p.cmd)
+	}
+	d := DiffCmds(old, cmds)
+	var halted []*proc
+	for _, label := range append(d.Removed, d.Changed...) {
+		p := s.procs[label]
+		close(p.stop)
+		halted = append(halted, p)
+		delete(s.procs, label)
+	}
+	s.mu.Unlock()
+	for _, p := range halted {
+		<-p.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range cmds {
+		if _, ok := s.procs[c.name()]; !ok {
+			s.procs[c.name()] = s.start(ctx, c)
+		}
+	}
+	return d
+}
+
+// Stop stops all commands.
+func (s *Supervisor) Stop() {
+	s.Apply(context.Background(), nil)
+}
+
+// Watch applies the Procfile at path, then polls it every interval and
+// applies it again when it changes, until ctx is done. Errors reading
+// the file are passed to onError, if not nil, and leave the commands
+// unchanged.
+func (s *Supervisor) Watch(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	var mod time.Time
+	var size int64 = -1
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if fi, err := os.Stat(path); err != nil {
+			if onError != nil {
+				onError(err)
+			}
+		} else if !fi.ModTime().Equal(mod) || fi.Size() != size {
+			mod, size = fi.ModTime(), fi.Size()
+			if err := s.reload(ctx, path); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Supervisor) reload(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cmds, err := ParseProcfile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	s.Apply(ctx, cmds)
+	return nil
+}
+
+func (s *Supervisor) start(ctx context.Context, c *Cmd) *proc {
+	p := &proc{cmd: c, stop: make(chan struct{}), done: make(chan struct{})}
+	run := *c
+	if run.Stdout == nil {
+		run.Stdout = s.Stdout
+	}
+	if run.Stderr == nil {
+		run.Stderr = s.Stderr
+	}
+	delay := s.RestartDelay
+	if delay == 0 {
+		delay = time.Second
+	}
+	go func() {
+		defer close(p.done)
+		for {
+			s.batch.run(ctx, &run, run.Timeout, p.stop)
+			select {
+			case <-time.After(delay):
+			case <-p.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return p
+}
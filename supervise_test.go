@@ -0,0 +1,65 @@
+package command
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSupervisorApply(t *testing.T) {
+	parse := func(procfile string) []*Cmd {
+		cmds, err := ParseProcfile(strings.NewReader(procfile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cmds
+	}
+	s := &Supervisor{}
+	defer s.Stop()
+	d := s.Apply(context.Background(), parse("# services\na: sleep 10\nb: sleep 10\n\nc: sleep 10\n"))
+	if want := (CmdDiff{Added: []string{"a", "b", "c"}}); !reflect.DeepEqual(d, want) {
+		t.Errorf("diff %+v, want %+v", d, want)
+	}
+	a := s.procs["a"]
+
+	d = s.Apply(context.Background(), parse("a: sleep 10\nb: sleep 20\nd: sleep 10\n"))
+	want := CmdDiff{Added: []string{"d"}, Removed: []string{"c"}, Changed: []string{"b"}}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("diff %+v, want %+v", d, want)
+	}
+	if s.procs["a"] != a {
+		t.Error("unchanged command restarted")
+	}
+	if len(s.procs) != 3 {
+		t.Errorf("%d commands supervised, want 3", len(s.procs))
+	}
+}
+
+func TestParseProcfileErrors(t *testing.T) {
+	for _, procfile := range []string{"sleep 10\n", "a: x\na: y\n"} {
+		if _, err := ParseProcfile(strings.NewReader(procfile)); err == nil {
+			t.Errorf("%q: no error", procfile)
+		}
+	}
+}
+
+func TestSupervisorStopAtOnce(t *testing.T) {
+	var procfile strings.Builder
+	for _, label := range []string{"a", "b", "c", "d"} {
+		procfile.WriteString(label + `: trap "sleep 0.3; exit" TERM; while :; do sleep 0.05; done` + "\n")
+	}
+	cmds, err := ParseProcfile(strings.NewReader(procfile.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Supervisor{}
+	s.Apply(context.Background(), cmds)
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	s.Stop()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("stopping 4 commands took %v, want them stopped at once", d)
+	}
+}
@@ -0,0 +1,46 @@
+package command
+
+import "time"
+
+// timeouts holds the timeout scaling settings of a batch.
+type timeouts struct {
+	scale    float64
+	min, max time.Duration
+}
+
+// timeouts returns the timeout settings of b, falling back to the
+// environment for those that are not set.
+func (b *Batch) timeouts() (timeouts, error) {
+	ts := timeouts{scale: b.TimeoutScale, min: b.MinTimeout, max: b.MaxTimeout}
+	var env Config
+	if err := env.setEnv("timeout-scale", "timeout-min", "timeout-max"); err != nil {
+		return ts, err
+	}
+	if ts.scale == 0 {
+		ts.scale = env.TimeoutScale
+	}
+	if ts.min == 0 {
+		ts.min = env.MinTimeout
+	}
+	if ts.max == 0 {
+		ts.max = env.MaxTimeout
+	}
+	return ts, nil
+}
+
+// apply returns the effective value of timeout d.
+func (ts timeouts) apply(d time.Duration) time.Duration {
+	if d == 0 {
+		return 0
+	}
+	if ts.scale != 0 {
+		d = time.Duration(float64(d) * ts.scale)
+	}
+	if ts.min != 0 && d < ts.min {
+		d = ts.min
+	}
+	if ts.max != 0 && d > ts.max {
+		d = ts.max
+	}
+	return d
+}
@@ -0,0 +1,29 @@
+package command
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimeoutScale(t *testing.T) {
+	t.Setenv("COMMAND_TIMEOUT_SCALE", "3")
+	t.Setenv("COMMAND_TIMEOUT_MAX", "25s")
+	b := &Batch{
+		Cmds: []*Cmd{
+			NewCmd("true", time.Second),
+			NewCmd("true", 10*time.Second),
+			NewCmd("true", 0),
+		},
+		MinTimeout: 5 * time.Second,
+	}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []time.Duration{5 * time.Second, 25 * time.Second, 0} {
+		if got := results[i].Timeout; got != want {
+			t.Errorf("results[%d].Timeout = %v, want %v", i, got, want)
+		}
+	}
+}